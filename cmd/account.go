@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/devproje/commando"
+	"github.com/devproje/commando/option"
+	"github.com/devproje/neko-engine/common/service"
+)
+
+func exportAccount(n *commando.Node) error {
+	id, err := option.ParseString(*n.MustGetOpt("id"), n)
+	if err != nil {
+		return err
+	}
+
+	archive, err := service.NewArchiveService().Export(id)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(archive, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	output, _ := option.ParseString(*n.MustGetOpt("output"), n)
+	if output == "" {
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	if err = os.WriteFile(output, raw, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Account %s exported to %s\n", id, output)
+	return nil
+}
+
+func importAccount(n *commando.Node) error {
+	file, err := option.ParseString(*n.MustGetOpt("file"), n)
+	if err != nil {
+		return err
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var archive service.Archive
+	if err = json.Unmarshal(raw, &archive); err != nil {
+		return err
+	}
+
+	id, _ := option.ParseString(*n.MustGetOpt("id"), n)
+	overwrite, _ := option.ParseBool(*n.MustGetOpt("overwrite"), n)
+	trusted, _ := option.ParseBool(*n.MustGetOpt("trusted"), n)
+	if err = service.NewArchiveService().Import(id, &archive, overwrite, trusted); err != nil {
+		return err
+	}
+
+	if id == "" {
+		id = archive.User.ID
+	}
+
+	fmt.Printf("Account %s imported from %s\n", id, file)
+	return nil
+}
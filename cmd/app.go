@@ -8,6 +8,7 @@ import (
 	"github.com/devproje/commando/types"
 	"github.com/devproje/neko-engine/common"
 	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/core"
 	"github.com/devproje/neko-engine/internal"
 )
 
@@ -36,6 +37,7 @@ func checkVersion(n *commando.Node) error {
 
 func serve(n *commando.Node) error {
 	sl := common.New()
+	go core.NewServerCore(sl)
 	internal.NewInternalServer(sl)
 
 	return nil
@@ -64,6 +66,73 @@ func main() {
 
 	command.Root("version", "checking neko-engine version", checkVersion)
 
+	command.ComplexRoot("account", "managing neko-engine user accounts", []commando.Node{
+		command.Then("export", "export user data as a JSON archive", exportAccount,
+			types.OptionData{
+				Name:  "id",
+				Desc:  "user id",
+				Short: []string{"i"},
+				Type:  types.STRING,
+			},
+			types.OptionData{
+				Name:  "output",
+				Desc:  "archive file path (default: stdout)",
+				Short: []string{"o"},
+				Type:  types.STRING,
+			},
+		),
+		command.Then("import", "import user data from a JSON archive", importAccount,
+			types.OptionData{
+				Name:  "file",
+				Desc:  "archive file path",
+				Short: []string{"f"},
+				Type:  types.STRING,
+			},
+			types.OptionData{
+				Name:  "id",
+				Desc:  "target user id (default: archived user id)",
+				Short: []string{"i"},
+				Type:  types.STRING,
+			},
+			types.OptionData{
+				Name: "overwrite",
+				Desc: "replace existing chat history of the target user",
+				Type: types.BOOLEAN,
+			},
+			types.OptionData{
+				Name: "trusted",
+				Desc: "restore the archived credits, affinity and total chat count",
+				Type: types.BOOLEAN,
+			},
+		),
+	})
+
+	command.ComplexRoot("role", "managing neko-engine roles", []commando.Node{
+		command.Then("list", "list all roles", listRoles),
+		command.Then("create", "create a new role", createRole, roleOptions()...),
+		command.Then("update", "update a role", updateRole, append(roleOptions(), types.OptionData{
+			Name: "id",
+			Desc: "role id",
+			Type: types.INTEGER,
+		})...),
+		command.Then("delete", "delete a role", deleteRole,
+			types.OptionData{
+				Name: "id",
+				Desc: "role id",
+				Type: types.INTEGER,
+			},
+			types.OptionData{
+				Name: "reassign",
+				Desc: "role id to move assigned users to",
+				Type: types.INTEGER,
+			},
+		),
+	})
+
+	command.ComplexRoot("history", "managing stored chat history", []commando.Node{
+		command.Then("reencrypt", "re-encrypt chat history with the active encryption key", reencryptHistory),
+	})
+
 	if err := command.Execute(); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 		return
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/devproje/commando"
+	"github.com/devproje/neko-engine/common/service"
+)
+
+func reencryptHistory(n *commando.Node) error {
+	count, err := service.NewMemoryService().Reencrypt()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d history rows re-encrypted\n", count)
+
+	count, err = service.NewChannelService().Reencrypt()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d channel messages re-encrypted\n", count)
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/devproje/commando"
+	"github.com/devproje/commando/option"
+	"github.com/devproje/commando/types"
+	"github.com/devproje/neko-engine/common/service"
+)
+
+func hasOpt(n *commando.Node, name string) bool {
+	return slices.Contains(n.Commando.Args(), "--"+name)
+}
+
+func rolePatch(n *commando.Node) (*service.RolePatch, error) {
+	var patch service.RolePatch
+	if hasOpt(n, "name") {
+		name, err := option.ParseString(*n.MustGetOpt("name"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		patch.Name = &name
+	}
+
+	if hasOpt(n, "limit") {
+		limit, err := option.ParseInt(*n.MustGetOpt("limit"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		value := int(limit)
+		patch.Limit = &value
+	}
+
+	if hasOpt(n, "token-limit") {
+		limit, err := option.ParseInt(*n.MustGetOpt("token-limit"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		value := int(limit)
+		patch.TokenLimit = &value
+	}
+
+	if hasOpt(n, "minute-limit") {
+		limit, err := option.ParseInt(*n.MustGetOpt("minute-limit"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		value := int(limit)
+		patch.MinuteLimit = &value
+	}
+
+	if hasOpt(n, "hour-limit") {
+		limit, err := option.ParseInt(*n.MustGetOpt("hour-limit"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		value := int(limit)
+		patch.HourLimit = &value
+	}
+
+	if hasOpt(n, "prompt-limit") {
+		limit, err := option.ParseInt(*n.MustGetOpt("prompt-limit"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		value := int(limit)
+		patch.PromptLimit = &value
+	}
+
+	if hasOpt(n, "ephemeral-free") {
+		free, err := option.ParseBool(*n.MustGetOpt("ephemeral-free"), n)
+		if err != nil {
+			return nil, err
+		}
+
+		patch.EphemeralFree = &free
+	}
+
+	return &patch, nil
+}
+
+func listRoles(n *commando.Node) error {
+	roles, err := service.NewRoleService().ListRoles()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-4s %-16s %-8s %-12s %-8s %-8s %s\n", "ID", "NAME", "LIMIT", "TOKEN_LIMIT", "PER_MIN", "PER_HOUR", "EPHEMERAL_FREE")
+	for _, role := range roles {
+		fmt.Printf("%-4d %-16s %-8d %-12d %-8d %-8d %t\n",
+			role.Id, role.Name, role.Limit, role.TokenLimit, role.MinuteLimit, role.HourLimit, role.EphemeralFree,
+		)
+	}
+
+	return nil
+}
+
+func createRole(n *commando.Node) error {
+	patch, err := rolePatch(n)
+	if err != nil {
+		return err
+	}
+
+	if patch.Name == nil || patch.Limit == nil {
+		return fmt.Errorf("--name and --limit options are required")
+	}
+
+	role, err := service.NewRoleService().CreateRole(patch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Role %s created with id %d\n", role.Name, role.Id)
+	return nil
+}
+
+func updateRole(n *commando.Node) error {
+	id, err := option.ParseInt(*n.MustGetOpt("id"), n)
+	if err != nil {
+		return err
+	}
+
+	patch, err := rolePatch(n)
+	if err != nil {
+		return err
+	}
+
+	role, err := service.NewRoleService().UpdateRole(int(id), patch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Role %d updated: %s (limit %d)\n", role.Id, role.Name, role.Limit)
+	return nil
+}
+
+func deleteRole(n *commando.Node) error {
+	id, err := option.ParseInt(*n.MustGetOpt("id"), n)
+	if err != nil {
+		return err
+	}
+
+	var reassign int64
+	if hasOpt(n, "reassign") {
+		reassign, err = option.ParseInt(*n.MustGetOpt("reassign"), n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = service.NewRoleService().DeleteRole(int(id), int(reassign)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Role %d deleted\n", id)
+	return nil
+}
+
+func roleOptions() []types.OptionData {
+	return []types.OptionData{
+		{
+			Name: "name",
+			Desc: "role name",
+			Type: types.STRING,
+		},
+		{
+			Name: "limit",
+			Desc: "daily chat limit, 0 with a token budget only uses the budget",
+			Type: types.INTEGER,
+		},
+		{
+			Name: "token-limit",
+			Desc: "daily token budget, 0 disables it",
+			Type: types.INTEGER,
+		},
+		{
+			Name: "minute-limit",
+			Desc: "requests per minute, 0 disables it",
+			Type: types.INTEGER,
+		},
+		{
+			Name: "hour-limit",
+			Desc: "requests per hour, 0 disables it",
+			Type: types.INTEGER,
+		},
+		{
+			Name: "prompt-limit",
+			Desc: "custom instruction length, 0 disables them",
+			Type: types.INTEGER,
+		},
+		{
+			Name: "ephemeral-free",
+			Desc: "ephemeral chats do not count against the limit",
+			Type: types.BOOLEAN,
+		},
+	}
+}
@@ -1,12 +1,22 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/devproje/neko-engine/common/service"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AccountController struct {
-	Acc *service.AccountService
+	Acc    *service.AccountService
+	Quota  *service.QuotaService
+	Reset  *service.ResetService
+	Prompt *service.PromptService
+	Credit *service.CreditService
+	Member *service.MembershipService
 }
 
 type UserForm struct {
@@ -14,8 +24,39 @@ type UserForm struct {
 	Author string `json:"author"`
 }
 
-func NewAccountController(acc *service.AccountService) *AccountController {
-	return &AccountController{Acc: acc}
+type BanForm struct {
+	ModeratorId string     `json:"moderator_id"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type CreditForm struct {
+	Amount      int    `json:"amount"`
+	ModeratorId string `json:"moderator_id"`
+	Reason      string `json:"reason"`
+}
+
+type PreferenceForm struct {
+	Persona   *string `json:"persona"`
+	Ephemeral *bool   `json:"ephemeral"`
+}
+
+type RoleAssignForm struct {
+	RoleId      int        `json:"role_id"`
+	ModeratorId string     `json:"moderator_id"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+func NewAccountController(
+	acc *service.AccountService,
+	quota *service.QuotaService,
+	reset *service.ResetService,
+	prompt *service.PromptService,
+	credit *service.CreditService,
+	member *service.MembershipService,
+) *AccountController {
+	return &AccountController{Acc: acc, Quota: quota, Reset: reset, Prompt: prompt, Credit: credit, Member: member}
 }
 
 func (ac *AccountController) RegisterUser(ctx *gin.Context) {
@@ -56,15 +97,297 @@ func (ac *AccountController) FetchAccount(ctx *gin.Context) {
 		return
 	}
 
+	perks := ac.Member.Apply(acc)
+
+	// tiers are defined per persona, so the tier is only resolved if the
+	// caller names one
+	affinity := gin.H{"score": acc.Sentiment, "tier": nil}
+	if name := ctx.Query("persona"); name != "" {
+		if persona, err := ac.Prompt.Read(name); err == nil {
+			if tier := persona.Tier(acc.Sentiment); tier != nil {
+				affinity["tier"] = tier.Name
+			}
+		}
+	}
+
 	role, _ := ac.Acc.GetRoleById(acc.RoleID)
+	role = ac.Member.Boost(role, perks)
 	ctx.JSON(200, gin.H{
-		"id":       acc.ID,
-		"role":     role.Name,
-		"limit":    role.Limit,
-		"nickname": acc.Username,
+		"id":              acc.ID,
+		"role":            role.Name,
+		"limit":           role.Limit,
+		"token_limit":     role.TokenLimit,
+		"nickname":        acc.Username,
+		"role_expires_at": acc.RoleExpiresAt,
 		"usage": gin.H{
 			"current": acc.Count,
+			"tokens":  acc.TokenCount,
 			"total":   acc.Total,
 		},
+		"remaining":  ac.Quota.Remaining(acc, role),
+		"credits":    acc.Credits,
+		"resets_at":  ac.Reset.NextReset(acc),
+		"affinity":   affinity,
+		"membership": perks,
+	})
+}
+
+func (ac *AccountController) AssignRole(ctx *gin.Context) {
+	var req RoleAssignForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.RoleId == 0 || req.ModeratorId == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"expires_at\" parameter must be in the future.",
+		})
+		return
+	}
+
+	acc, err := ac.Acc.AssignRole(ctx.Param("id"), req.RoleId, req.ModeratorId, req.Reason, req.ExpiresAt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find account or role information.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to assign role",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":              acc.ID,
+		"role_id":         acc.RoleID,
+		"role_expires_at": acc.RoleExpiresAt,
+	})
+}
+
+func (ac *AccountController) FetchRoleChanges(ctx *gin.Context) {
+	list, err := ac.Acc.RoleChanges(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load role changes",
+		})
+		return
+	}
+
+	changes := make([]gin.H, 0, len(list))
+	for _, change := range list {
+		changes = append(changes, gin.H{
+			"from":         change.FromRoleID,
+			"to":           change.ToRoleID,
+			"moderator_id": change.ModeratorID,
+			"reason":       change.Reason,
+			"expires_at":   change.ExpiresAt,
+			"created_at":   change.CreatedAt,
+		})
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":      ctx.Param("id"),
+		"changes": changes,
+	})
+}
+
+func (ac *AccountController) BanUser(ctx *gin.Context) {
+	var req BanForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.ModeratorId == "" || req.Reason == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"expires_at\" parameter must be in the future.",
+		})
+		return
+	}
+
+	acc, err := ac.Acc.Ban(ctx.Param("id"), req.ModeratorId, req.Reason, req.ExpiresAt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to ban user",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":         acc.ID,
+		"banned":     acc.Banned,
+		"reason":     acc.BanReason,
+		"banned_by":  acc.BannedBy,
+		"expires_at": acc.BanExpiresAt,
 	})
 }
+
+func (ac *AccountController) UnbanUser(ctx *gin.Context) {
+	err := ac.Acc.Unban(ctx.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to unban user",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "User has been unbanned.",
+	})
+}
+
+func (ac *AccountController) GrantCredits(ctx *gin.Context) {
+	var req CreditForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.Amount == 0 || req.ModeratorId == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	balance, err := ac.Credit.Grant(ctx.Param("id"), req.Amount, req.ModeratorId, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCreditBalance):
+			ctx.JSON(400, gin.H{
+				"errno": "The user does not have enough credits to take back.",
+			})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(404, gin.H{
+				"errno": "Could not find account information.",
+			})
+		default:
+			ctx.JSON(500, gin.H{
+				"errno": "Failed to grant credits",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":      ctx.Param("id"),
+		"credits": balance,
+	})
+}
+
+func (ac *AccountController) FetchCredits(ctx *gin.Context) {
+	acc, err := ac.Acc.ReadUser(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(401, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	list, err := ac.Credit.Ledger(acc.ID)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load credit ledger",
+		})
+		return
+	}
+
+	entries := make([]gin.H, 0, len(list))
+	for _, entry := range list {
+		entries = append(entries, gin.H{
+			"amount":       entry.Amount,
+			"balance":      entry.Balance,
+			"moderator_id": entry.ModeratorID,
+			"reason":       entry.Reason,
+			"created_at":   entry.CreatedAt,
+		})
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":      acc.ID,
+		"credits": acc.Credits,
+		"ledger":  entries,
+	})
+}
+
+func (ac *AccountController) FetchPreferences(ctx *gin.Context) {
+	acc, err := ac.Acc.ReadUser(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(401, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"persona":   acc.DefaultPersona,
+		"ephemeral": acc.PreferEphemeral,
+	})
+}
+
+func (ac *AccountController) UpdatePreferences(ctx *gin.Context) {
+	var req PreferenceForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	acc, err := ac.Acc.ReadUser(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(401, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	fields := make(map[string]any)
+	if req.Persona != nil {
+		if *req.Persona != "" {
+			if _, err = ac.Prompt.Read(*req.Persona); err != nil {
+				ctx.JSON(404, gin.H{
+					"errno": fmt.Sprintf("'%s' persona is not found", *req.Persona),
+				})
+				return
+			}
+		}
+
+		fields["default_persona"] = *req.Persona
+	}
+
+	if req.Ephemeral != nil {
+		fields["prefer_ephemeral"] = *req.Ephemeral
+	}
+
+	if len(fields) == 0 {
+		ac.FetchPreferences(ctx)
+		return
+	}
+
+	if err = ac.Acc.PatchUser(acc.ID, fields); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to save preferences",
+		})
+		return
+	}
+
+	ac.FetchPreferences(ctx)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ArchiveController struct {
+	Archive *service.ArchiveService
+}
+
+func NewArchiveController(archive *service.ArchiveService) *ArchiveController {
+	return &ArchiveController{Archive: archive}
+}
+
+func (ac *ArchiveController) ExportAccount(ctx *gin.Context) {
+	id := ctx.Param("id")
+	archive, err := ac.Archive.Export(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to export account data",
+		})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"neko-%s.json\"", id))
+	ctx.JSON(200, archive)
+}
+
+func (ac *ArchiveController) ImportAccount(ctx *gin.Context) {
+	var archive service.Archive
+	if err := ctx.ShouldBindBodyWithJSON(&archive); err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	overwrite := ctx.Query("overwrite") == "true"
+	trusted := ctx.Query("trusted") == "true"
+	err := ac.Archive.Import(ctx.Param("id"), &archive, overwrite, trusted)
+	if errors.Is(err, service.ErrArchiveVersion) {
+		ctx.JSON(400, gin.H{
+			"errno": err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrInstructionsDisabled) || errors.Is(err, service.ErrInstructionsTooLong) || errors.Is(err, service.ErrInstructionsRejected) {
+		ctx.JSON(400, gin.H{
+			"errno": "The custom instructions of the archive are not allowed for this account.",
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrArchiveExists) {
+		ctx.JSON(409, gin.H{
+			"errno": "Account already has chat history. Retry with \"overwrite=true\" to replace it.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to import account data",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Account data has been imported.",
+	})
+}
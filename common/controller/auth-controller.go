@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/devproje/neko-engine/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	OAUTH_STATE_COOKIE = "neko_oauth_state"
+	OAUTH_STATE_AGE    = 600 // seconds
+)
+
+type AuthController struct {
+	Session *service.SessionService
+}
+
+func NewAuthController(session *service.SessionService) *AuthController {
+	return &AuthController{Session: session}
+}
+
+// Login redirects to the Discord authorization page. The state is kept in
+// a cookie and checked on the callback to prevent login CSRF.
+func (ac *AuthController) Login(ctx *gin.Context) {
+	state, err := service.RandomToken(16)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to start login",
+		})
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(OAUTH_STATE_COOKIE, state, OAUTH_STATE_AGE, "/", "", ctx.Request.TLS != nil, true)
+	ctx.Redirect(http.StatusFound, ac.Session.Discord.LoginURL(state))
+}
+
+func (ac *AuthController) Callback(ctx *gin.Context) {
+	state, _ := ctx.Cookie(OAUTH_STATE_COOKIE)
+	query := ctx.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query)) != 1 {
+		ctx.JSON(400, gin.H{
+			"errno": "Login state does not match. Please try again.",
+		})
+		return
+	}
+
+	ctx.SetCookie(OAUTH_STATE_COOKIE, "", -1, "/", "", ctx.Request.TLS != nil, true)
+	if reason := ctx.Query("error"); reason != "" {
+		ctx.JSON(401, gin.H{
+			"errno": fmt.Sprintf("Discord login was cancelled: %s", reason),
+		})
+		return
+	}
+
+	code := ctx.Query("code")
+	if code == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"code\" parameter is missing.",
+		})
+		return
+	}
+
+	token, session, usr, err := ac.Session.Login(code, ctx.Request.UserAgent())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		if errors.Is(err, service.ErrDiscordRequest) {
+			ctx.JSON(502, gin.H{
+				"errno": "Failed to log in with Discord",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to create session",
+		})
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(middleware.SESSION_COOKIE, token, int(time.Until(session.ExpiresAt).Seconds()), "/", "", ctx.Request.TLS != nil, true)
+	ctx.JSON(200, gin.H{
+		"token":      token,
+		"expires_at": session.ExpiresAt,
+		"user": gin.H{
+			"id":       usr.ID,
+			"nickname": usr.Username,
+		},
+	})
+}
+
+func (ac *AuthController) FetchSession(ctx *gin.Context) {
+	session := ctx.MustGet(middleware.SESSION_KEY).(*repository.Session)
+	ctx.JSON(200, gin.H{
+		"id":         session.UserID,
+		"created_at": session.CreatedAt,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+func (ac *AuthController) Logout(ctx *gin.Context) {
+	session := ctx.MustGet(middleware.SESSION_KEY).(*repository.Session)
+	if err := ac.Session.Revoke(session.UserID, session.ID); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to log out",
+		})
+		return
+	}
+
+	ctx.SetCookie(middleware.SESSION_COOKIE, "", -1, "/", "", ctx.Request.TLS != nil, true)
+	ctx.JSON(200, gin.H{
+		"message": "You have been logged out.",
+	})
+}
+
+func (ac *AuthController) ListSessions(ctx *gin.Context) {
+	current := ctx.MustGet(middleware.SESSION_KEY).(*repository.Session)
+	list, err := ac.Session.ListSessions(current.UserID)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load sessions",
+		})
+		return
+	}
+
+	sessions := make([]gin.H, 0, len(list))
+	for _, session := range list {
+		sessions = append(sessions, gin.H{
+			"id":         session.ID,
+			"user_agent": session.UserAgent,
+			"current":    session.ID == current.ID,
+			"created_at": session.CreatedAt,
+			"expires_at": session.ExpiresAt,
+		})
+	}
+
+	ctx.JSON(200, gin.H{
+		"sessions": sessions,
+	})
+}
+
+func (ac *AuthController) RevokeSession(ctx *gin.Context) {
+	current := ctx.MustGet(middleware.SESSION_KEY).(*repository.Session)
+	id, err := strconv.ParseUint(ctx.Param("sid"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"sid\" parameter must be a number.",
+		})
+		return
+	}
+
+	if err = ac.Session.Revoke(current.UserID, uint(id)); err != nil {
+		if errors.Is(err, service.ErrSessionInvalid) {
+			ctx.JSON(404, gin.H{
+				"errno": "Session is not found.",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to revoke session",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Session has been revoked.",
+	})
+}
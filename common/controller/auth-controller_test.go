@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/devproje/neko-engine/common/service/servicetest"
+	"github.com/devproje/neko-engine/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthRouter serves the auth endpoints against the mock Discord API of
+// servicetest.
+func newAuthRouter(t *testing.T) (*gin.Engine, *servicetest.SessionStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := &servicetest.SessionStore{}
+	ss := &service.SessionService{
+		Account: servicetest.NewAccounts(&repository.User{ID: servicetest.USER_ID, Username: "neko"}),
+		Discord: servicetest.NewDiscord(t),
+		Store:   store,
+	}
+
+	ac := NewAuthController(ss)
+	app := gin.New()
+	app.GET("/auth/login", ac.Login)
+	app.GET("/auth/callback", ac.Callback)
+	app.GET("/auth/session", middleware.CheckSession(ss), ac.FetchSession)
+
+	return app, store
+}
+
+func callback(app *gin.Engine, cookie, state, code string) *httptest.ResponseRecorder {
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?"+query.Encode(), nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: OAUTH_STATE_COOKIE, Value: cookie})
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthLoginSetsState(t *testing.T) {
+	app, _ := newAuthRouter(t)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("GET /auth/login returned %d, want 302", rec.Code)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+
+	var state string
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == OAUTH_STATE_COOKIE {
+			state = cookie.Value
+		}
+	}
+
+	if state == "" || location.Query().Get("state") != state {
+		t.Errorf("redirect state %q does not match the cookie %q", location.Query().Get("state"), state)
+	}
+}
+
+func TestAuthCallbackRejectsState(t *testing.T) {
+	app, store := newAuthRouter(t)
+
+	cases := map[string][2]string{
+		"missing cookie": {"", "state"},
+		"mismatch":       {"state", "other"},
+		"empty":          {"", ""},
+	}
+
+	for name, c := range cases {
+		if rec := callback(app, c[0], c[1], servicetest.CODE); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: callback returned %d, want 400", name, rec.Code)
+		}
+	}
+
+	if len(store.Sessions) != 0 {
+		t.Errorf("rejected callbacks issued %d sessions", len(store.Sessions))
+	}
+}
+
+func TestAuthCallbackBadCode(t *testing.T) {
+	app, store := newAuthRouter(t)
+
+	if rec := callback(app, "state", "state", "bad-code"); rec.Code != http.StatusBadGateway {
+		t.Errorf("callback with a bad code returned %d, want 502", rec.Code)
+	}
+
+	if len(store.Sessions) != 0 {
+		t.Errorf("failed callback issued %d sessions", len(store.Sessions))
+	}
+}
+
+func TestAuthCallbackIssuesSession(t *testing.T) {
+	app, _ := newAuthRouter(t)
+
+	rec := callback(app, "state", "state", servicetest.CODE)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", rec.Code, rec.Body)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+		User  struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid callback response: %v", err)
+	}
+
+	if body.Token == "" || body.User.ID != servicetest.USER_ID {
+		t.Fatalf("callback returned token %q for user %q", body.Token, body.User.ID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	req.Header.Set("Authorization", "Bearer "+body.Token)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /auth/session returned %d: %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	req.Header.Set("Authorization", "Bearer forged")
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /auth/session with a forged token returned %d, want 401", rec.Code)
+	}
+}
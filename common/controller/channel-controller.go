@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelController struct {
+	Channel *service.ChannelService
+}
+
+type ChannelMessageForm struct {
+	AuthorId   string `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Content    string `json:"content"`
+	Bot        bool   `json:"bot"`
+}
+
+func NewChannelController(channel *service.ChannelService) *ChannelController {
+	return &ChannelController{Channel: channel}
+}
+
+func (cc *ChannelController) IngestMessage(ctx *gin.Context) {
+	var req ChannelMessageForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.Content == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	if !cc.Channel.Enabled() {
+		ctx.JSON(404, gin.H{
+			"errno": "Shared channel context is disabled.",
+		})
+		return
+	}
+
+	err := cc.Channel.Ingest(ctx.Param("cid"), &repository.ChannelMessage{
+		AuthorID:   req.AuthorId,
+		AuthorName: req.AuthorName,
+		Content:    req.Content,
+		Bot:        req.Bot,
+	})
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to store channel message",
+		})
+		return
+	}
+
+	ctx.Status(204)
+}
+
+func (cc *ChannelController) FlushChannel(ctx *gin.Context) {
+	if err := cc.Channel.Flush(ctx.Param("cid")); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to flush channel messages",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Channel context has been cleared.",
+	})
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GuildController struct {
+	Guild *service.GuildService
+	Quota *service.QuotaService
+	Usage *service.UsageService
+}
+
+type GuildForm struct {
+	Id     string  `json:"id"`
+	Name   *string `json:"name"`
+	RoleId *int    `json:"role_id"`
+}
+
+func NewGuildController(guild *service.GuildService, quota *service.QuotaService, usage *service.UsageService) *GuildController {
+	return &GuildController{Guild: guild, Quota: quota, Usage: usage}
+}
+
+func (f *GuildForm) patch() *service.GuildPatch {
+	return &service.GuildPatch{
+		Name:   f.Name,
+		RoleID: f.RoleId,
+	}
+}
+
+func (gc *GuildController) guildView(guild *repository.Guild, role *repository.Role) gin.H {
+	return gin.H{
+		"id":   guild.ID,
+		"name": guild.Name,
+		"role": role.Name,
+		"pool": gin.H{
+			"limit":       role.Limit,
+			"token_limit": role.TokenLimit,
+			"current":     guild.Count,
+			"tokens":      guild.TokenCount,
+			"remaining":   gc.Quota.GuildRemaining(guild, role),
+		},
+	}
+}
+
+func (gc *GuildController) FetchGuild(ctx *gin.Context) {
+	guild, role, err := gc.Guild.ReadGuild(ctx.Param("gid"))
+	if err != nil {
+		ctx.JSON(404, gin.H{
+			"errno": "Guild is not found.",
+		})
+		return
+	}
+
+	ctx.JSON(200, gc.guildView(guild, role))
+}
+
+func (gc *GuildController) CreateGuild(ctx *gin.Context) {
+	var req GuildForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.Id == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	guild, err := gc.Guild.CreateGuild(req.Id, req.patch())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrGuildExists):
+			ctx.JSON(409, gin.H{
+				"errno": "Guild is already registered.",
+			})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(404, gin.H{
+				"errno": "Role is not found.",
+			})
+		default:
+			ctx.JSON(500, gin.H{
+				"errno": "Failed to create guild",
+			})
+		}
+		return
+	}
+
+	_, role, err := gc.Guild.ReadGuild(guild.ID)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load guild",
+		})
+		return
+	}
+
+	ctx.JSON(201, gc.guildView(guild, role))
+}
+
+func (gc *GuildController) UpdateGuild(ctx *gin.Context) {
+	var req GuildForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	if _, err := gc.Guild.UpdateGuild(ctx.Param("gid"), req.patch()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(404, gin.H{
+				"errno": "Guild or role is not found.",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to update guild",
+		})
+		return
+	}
+
+	gc.FetchGuild(ctx)
+}
+
+func (gc *GuildController) DeleteGuild(ctx *gin.Context) {
+	if err := gc.Guild.DeleteGuild(ctx.Param("gid")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(404, gin.H{
+				"errno": "Guild is not found.",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to delete guild",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Guild has been deleted.",
+	})
+}
+
+// FetchGuildUsage returns the pool state of the guild and the usage of
+// its members, grouped by user unless another group is given.
+func (gc *GuildController) FetchGuildUsage(ctx *gin.Context) {
+	guild, role, err := gc.Guild.ReadGuild(ctx.Param("gid"))
+	if err != nil {
+		ctx.JSON(404, gin.H{
+			"errno": "Guild is not found.",
+		})
+		return
+	}
+
+	filter, ok := usageFilter(ctx)
+	if !ok {
+		return
+	}
+
+	filter.GuildID = guild.ID
+	group := ctx.DefaultQuery("group", "user")
+	list, err := gc.Usage.Report(group, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrUsageGroup) {
+			ctx.JSON(400, gin.H{
+				"errno": "The \"group\" parameter must be one of user, role, persona, model, guild or day.",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load usage",
+		})
+		return
+	}
+
+	view := gc.guildView(guild, role)
+	view["group"] = group
+	view["from"] = filter.From
+	view["to"] = filter.To
+	view["usage"] = list
+
+	ctx.JSON(200, view)
+}
@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	HISTORY_PAGE_DEFAULT = 20
+	HISTORY_PAGE_MAX     = 100
+)
+
+type HistoryController struct {
+	Memory *service.MemoryService
+}
+
+func NewHistoryController(memory *service.MemoryService) *HistoryController {
+	return &HistoryController{Memory: memory}
+}
+
+func historyView(hist *repository.History) gin.H {
+	attachments := make([]gin.H, 0, len(hist.Attachments))
+	for _, attach := range hist.Attachments {
+		attachments = append(attachments, gin.H{
+			"url":          attach.URL,
+			"filename":     attach.Filename,
+			"content_type": attach.ContentType,
+			"size":         attach.Size,
+			"hash":         attach.Hash,
+		})
+	}
+
+	return gin.H{
+		"id":        hist.ID,
+		"parent_id": hist.ParentID,
+		"content":   hist.Content,
+		"answer":    hist.Answer,
+		"persona":   hist.Persona,
+		"model":     hist.ModelName,
+		"nsfw":      hist.NSFW,
+		"usage": gin.H{
+			"prompt":    hist.PromptTokens,
+			"candidate": hist.CandidateTokens,
+			"total":     hist.TotalTokens,
+		},
+		"latency":       hist.Latency,
+		"finish_reason": hist.FinishReason,
+		"attachments":   attachments,
+		"created_at":    hist.CreatedAt,
+	}
+}
+
+func (hc *HistoryController) FetchHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"page\" parameter must be a positive number.",
+		})
+		return
+	}
+
+	size, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(HISTORY_PAGE_DEFAULT)))
+	if err != nil || size < 1 {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"limit\" parameter must be a positive number.",
+		})
+		return
+	}
+
+	if size > HISTORY_PAGE_MAX {
+		size = HISTORY_PAGE_MAX
+	}
+
+	list, total, err := hc.Memory.ListHistory(id, page, size)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load chat history",
+		})
+		return
+	}
+
+	histories := make([]gin.H, 0, len(list))
+	for _, hist := range list {
+		histories = append(histories, historyView(hist))
+	}
+
+	var active *uint
+	if head, err := hc.Memory.LastHistory(id); err == nil {
+		active = &head.ID
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":        id,
+		"page":      page,
+		"limit":     size,
+		"total":     total,
+		"active":    active,
+		"histories": histories,
+	})
+}
+
+func (hc *HistoryController) SearchHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	query := ctx.Query("q")
+	if query == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"q\" parameter is missing.",
+		})
+		return
+	}
+
+	size, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(HISTORY_PAGE_DEFAULT)))
+	if err != nil || size < 1 {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"limit\" parameter must be a positive number.",
+		})
+		return
+	}
+
+	if size > HISTORY_PAGE_MAX {
+		size = HISTORY_PAGE_MAX
+	}
+
+	list, err := hc.Memory.SearchHistory(id, query, size)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to search chat history",
+		})
+		return
+	}
+
+	histories := make([]gin.H, 0, len(list))
+	for _, hist := range list {
+		histories = append(histories, historyView(hist))
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":        id,
+		"query":     query,
+		"histories": histories,
+	})
+}
+
+func (hc *HistoryController) FetchBranches(ctx *gin.Context) {
+	id := ctx.Param("id")
+	hid, err := strconv.ParseUint(ctx.Param("hid"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"hid\" parameter must be a number.",
+		})
+		return
+	}
+
+	list, err := hc.Memory.ListBranches(id, uint(hid))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find chat history.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load chat branches",
+		})
+		return
+	}
+
+	branches := make([]gin.H, 0, len(list))
+	for _, hist := range list {
+		branches = append(branches, historyView(hist))
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":       id,
+		"branches": branches,
+	})
+}
+
+func (hc *HistoryController) CheckoutBranch(ctx *gin.Context) {
+	id := ctx.Param("id")
+	hid, err := strconv.ParseUint(ctx.Param("hid"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"hid\" parameter must be a number.",
+		})
+		return
+	}
+
+	leaf, err := hc.Memory.Checkout(id, uint(hid))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find chat history.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to switch chat branch",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Chat branch switched.",
+		"active":  historyView(leaf),
+	})
+}
+
+func (hc *HistoryController) PurgeLast(ctx *gin.Context) {
+	id := ctx.Param("id")
+	n, err := strconv.Atoi(ctx.DefaultQuery("n", "1"))
+	if err != nil || n < 1 {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"n\" parameter must be a positive number.",
+		})
+		return
+	}
+
+	if n == 1 {
+		err = hc.Memory.PurgeLast(id)
+	} else {
+		err = hc.Memory.PurgeN(id, n)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "There is no chat history to delete.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to delete chat history",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Chat history deleted.",
+	})
+}
+
+func (hc *HistoryController) DeleteHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	hid, err := strconv.ParseUint(ctx.Param("hid"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"hid\" parameter must be a number.",
+		})
+		return
+	}
+
+	err = hc.Memory.DeleteHistory(id, uint(hid))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find chat history.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to delete chat history",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Chat history deleted.",
+	})
+}
+
+func (hc *HistoryController) FlushHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := hc.Memory.FlushHistory(id); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to flush chat history",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "All chat history has been cleared.",
+	})
+}
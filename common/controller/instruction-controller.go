@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+)
+
+type InstructionController struct {
+	Instruction *service.InstructionService
+}
+
+type InstructionForm struct {
+	Content string `json:"content"`
+}
+
+func NewInstructionController(instruction *service.InstructionService) *InstructionController {
+	return &InstructionController{Instruction: instruction}
+}
+
+func (ic *InstructionController) FetchInstructions(ctx *gin.Context) {
+	content, limit, err := ic.Instruction.Read(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(401, gin.H{
+			"errno": "Could not find account information.",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"content": content,
+		"limit":   limit,
+	})
+}
+
+func (ic *InstructionController) UpdateInstructions(ctx *gin.Context) {
+	var req InstructionForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.Content == "" {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	content, err := ic.Instruction.Set(ctx.Param("id"), req.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInstructionsDisabled):
+			ctx.JSON(403, gin.H{
+				"errno": "Custom instructions are not available for your role.",
+			})
+		case errors.Is(err, service.ErrInstructionsTooLong):
+			ctx.JSON(400, gin.H{
+				"errno": "Custom instructions are too long for your role.",
+			})
+		case errors.Is(err, service.ErrInstructionsRejected):
+			ctx.JSON(400, gin.H{
+				"errno": "Custom instructions can not override the persona or system prompt.",
+			})
+		default:
+			ctx.JSON(500, gin.H{
+				"errno": "Failed to save custom instructions",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"content": content,
+	})
+}
+
+func (ic *InstructionController) ClearInstructions(ctx *gin.Context) {
+	if err := ic.Instruction.Clear(ctx.Param("id")); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to clear custom instructions",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Custom instructions have been cleared.",
+	})
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+)
+
+type MembershipController struct {
+	Membership *service.MembershipService
+}
+
+type MembershipForm struct {
+	Member bool     `json:"member"`
+	Roles  []string `json:"roles"`
+}
+
+func NewMembershipController(membership *service.MembershipService) *MembershipController {
+	return &MembershipController{Membership: membership}
+}
+
+// ReportMembership is called by the bot when a user joins or leaves the
+// official server or their roles there change.
+func (mc *MembershipController) ReportMembership(ctx *gin.Context) {
+	var req MembershipForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	if !mc.Membership.Enabled() {
+		ctx.JSON(403, gin.H{
+			"errno": "Official server membership perks are disabled.",
+		})
+		return
+	}
+
+	if _, err := mc.Membership.Report(ctx.Param("id"), req.Member, req.Roles); err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to update membership",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"id":         ctx.Param("id"),
+		"membership": mc.Membership.Perks(ctx.Param("id")),
+	})
+}
+
+func (mc *MembershipController) FetchMembership(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{
+		"id":         ctx.Param("id"),
+		"enabled":    mc.Membership.Enabled(),
+		"membership": mc.Membership.Perks(ctx.Param("id")),
+	})
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleController struct {
+	Role *service.RoleService
+}
+
+type RoleForm struct {
+	Name          *string `json:"name"`
+	Limit         *int    `json:"limit"`
+	TokenLimit    *int    `json:"token_limit"`
+	MinuteLimit   *int    `json:"minute_limit"`
+	HourLimit     *int    `json:"hour_limit"`
+	PromptLimit   *int    `json:"prompt_limit"`
+	EphemeralFree *bool   `json:"ephemeral_free"`
+}
+
+func NewRoleController(role *service.RoleService) *RoleController {
+	return &RoleController{Role: role}
+}
+
+func (f *RoleForm) patch() *service.RolePatch {
+	return &service.RolePatch{
+		Name:          f.Name,
+		Limit:         f.Limit,
+		TokenLimit:    f.TokenLimit,
+		MinuteLimit:   f.MinuteLimit,
+		HourLimit:     f.HourLimit,
+		PromptLimit:   f.PromptLimit,
+		EphemeralFree: f.EphemeralFree,
+	}
+}
+
+func roleView(role *repository.Role) gin.H {
+	return gin.H{
+		"id":             role.Id,
+		"name":           role.Name,
+		"limit":          role.Limit,
+		"token_limit":    role.TokenLimit,
+		"minute_limit":   role.MinuteLimit,
+		"hour_limit":     role.HourLimit,
+		"prompt_limit":   role.PromptLimit,
+		"ephemeral_free": role.EphemeralFree,
+	}
+}
+
+func roleParam(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("rid"))
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"rid\" parameter must be a number.",
+		})
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (rc *RoleController) ListRoles(ctx *gin.Context) {
+	list, err := rc.Role.ListRoles()
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load roles",
+		})
+		return
+	}
+
+	roles := make([]gin.H, 0, len(list))
+	for _, role := range list {
+		roles = append(roles, roleView(role))
+	}
+
+	ctx.JSON(200, gin.H{
+		"roles": roles,
+	})
+}
+
+func (rc *RoleController) CreateRole(ctx *gin.Context) {
+	var req RoleForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || req.Name == nil || *req.Name == "" || req.Limit == nil {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	role, err := rc.Role.CreateRole(req.patch())
+	if errors.Is(err, service.ErrRoleExists) {
+		ctx.JSON(409, gin.H{
+			"errno": "Role already exists.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to create role",
+		})
+		return
+	}
+
+	ctx.JSON(200, roleView(role))
+}
+
+func (rc *RoleController) UpdateRole(ctx *gin.Context) {
+	id, ok := roleParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req RoleForm
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil || (req.Name != nil && *req.Name == "") {
+		ctx.JSON(400, gin.H{
+			"errno": "JSON input parameter is missing. Please check the sent values.",
+		})
+		return
+	}
+
+	role, err := rc.Role.UpdateRole(id, req.patch())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find role.",
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrRoleExists) {
+		ctx.JSON(409, gin.H{
+			"errno": "Role already exists.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to update role",
+		})
+		return
+	}
+
+	ctx.JSON(200, roleView(role))
+}
+
+func (rc *RoleController) DeleteRole(ctx *gin.Context) {
+	id, ok := roleParam(ctx)
+	if !ok {
+		return
+	}
+
+	reassign, err := strconv.Atoi(ctx.DefaultQuery("reassign", "0"))
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"errno": "The \"reassign\" parameter must be a number.",
+		})
+		return
+	}
+
+	err = rc.Role.DeleteRole(id, reassign)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(404, gin.H{
+			"errno": "Could not find role.",
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrRoleProtected) {
+		ctx.JSON(403, gin.H{
+			"errno": "Built-in roles can not be deleted.",
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrRoleInUse) {
+		ctx.JSON(409, gin.H{
+			"errno": "Role is still assigned to users. Retry with \"reassign=<role id>\" to move them.",
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to delete role",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Role deleted.",
+	})
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	USAGE_DATE_FORMAT  = "2006-01-02"
+	USAGE_DEFAULT_DAYS = 30
+)
+
+type UsageController struct {
+	Usage *service.UsageService
+}
+
+func NewUsageController(usage *service.UsageService) *UsageController {
+	return &UsageController{Usage: usage}
+}
+
+// usageFilter reads the "from" and "to" dates of the report. "to" is
+// inclusive, so the whole day is part of the report.
+func usageFilter(ctx *gin.Context) (*repository.UsageFilter, bool) {
+	now := time.Now()
+	filter := repository.UsageFilter{
+		From: now.AddDate(0, 0, -USAGE_DEFAULT_DAYS),
+		To:   now,
+	}
+
+	if raw := ctx.Query("from"); raw != "" {
+		from, err := time.ParseInLocation(USAGE_DATE_FORMAT, raw, time.Local)
+		if err != nil {
+			ctx.JSON(400, gin.H{
+				"errno": "The \"from\" parameter must be a YYYY-MM-DD date.",
+			})
+			return nil, false
+		}
+
+		filter.From = from
+	}
+
+	if raw := ctx.Query("to"); raw != "" {
+		to, err := time.ParseInLocation(USAGE_DATE_FORMAT, raw, time.Local)
+		if err != nil {
+			ctx.JSON(400, gin.H{
+				"errno": "The \"to\" parameter must be a YYYY-MM-DD date.",
+			})
+			return nil, false
+		}
+
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	return &filter, true
+}
+
+func (uc *UsageController) report(ctx *gin.Context, filter *repository.UsageFilter, group string) {
+	list, err := uc.Usage.Report(group, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrUsageGroup) {
+			ctx.JSON(400, gin.H{
+				"errno": "The \"group\" parameter must be one of user, role, persona, model, guild or day.",
+			})
+			return
+		}
+
+		ctx.JSON(500, gin.H{
+			"errno": "Failed to load usage",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"group": group,
+		"from":  filter.From,
+		"to":    filter.To,
+		"usage": list,
+	})
+}
+
+func (uc *UsageController) FetchUsage(ctx *gin.Context) {
+	filter, ok := usageFilter(ctx)
+	if !ok {
+		return
+	}
+
+	filter.UserID = ctx.Query("user")
+	uc.report(ctx, filter, ctx.DefaultQuery("group", "day"))
+}
+
+func (uc *UsageController) FetchAccountUsage(ctx *gin.Context) {
+	filter, ok := usageFilter(ctx)
+	if !ok {
+		return
+	}
+
+	filter.UserID = ctx.Param("id")
+	uc.report(ctx, filter, ctx.DefaultQuery("group", "day"))
+}
@@ -3,14 +3,28 @@ package common
 import (
 	"github.com/devproje/neko-engine/common/controller"
 	"github.com/devproje/neko-engine/common/service"
+	"github.com/devproje/neko-engine/config"
 )
 
 type ServiceLoader struct {
-	Acc     *controller.AccountController
-	Chat    *controller.ChatController
-	Account *service.AccountService
-	Gemini  *service.GeminiService
-	Prompt  *service.PromptService
+	Acc       *controller.AccountController
+	Chat      *controller.ChatController
+	History   *controller.HistoryController
+	Archive   *controller.ArchiveController
+	Channel   *controller.ChannelController
+	Role      *controller.RoleController
+	Usage     *controller.UsageController
+	Inst      *controller.InstructionController
+	Guild     *controller.GuildController
+	Auth      *controller.AuthController
+	Member    *controller.MembershipController
+	Account   *service.AccountService
+	Gemini    *service.GeminiService
+	Memory    *service.MemoryService
+	Prompt    *service.PromptService
+	Retention *service.RetentionService
+	Session   *service.SessionService
+	Reset     *service.ResetService
 }
 
 func New() *ServiceLoader {
@@ -18,15 +32,57 @@ func New() *ServiceLoader {
 	gemini := service.NewGeminiService()
 	memory := service.NewMemoryService()
 	prompt := service.NewPromptService()
+	archive := service.NewArchiveService()
+	retention := service.NewRetentionService()
+	channel := service.NewChannelService()
+	role := service.NewRoleService()
+	quota := service.NewQuotaService()
+	rate := service.NewRateLimitService()
+	reset := service.NewResetService()
+	usage := service.NewUsageService()
+	pricing := service.NewPricingService()
+	instruction := service.NewInstructionService()
+	affinity := service.NewAffinityService(gemini, usage, pricing)
+	guild := service.NewGuildService()
+	credit := service.NewCreditService()
 
-	acc := controller.NewAccountController(account)
-	chat := controller.NewChatController(account, gemini, memory, prompt)
+	// the bot token is only needed to look members of the official server up
+	discord := service.NewDiscordClient(config.Load().Bot)
+	discord.BotToken = config.Load().Membership.BotToken
+
+	session := service.NewSessionService(account, discord)
+	membership := service.NewMembershipService(account, discord)
+
+	acc := controller.NewAccountController(account, quota, reset, prompt, credit, membership)
+	chat := controller.NewChatController(account, channel, gemini, memory, prompt, quota, rate, usage, pricing, affinity, guild, credit, membership)
+	history := controller.NewHistoryController(memory)
+	arc := controller.NewArchiveController(archive)
+	ch := controller.NewChannelController(channel)
+	rc := controller.NewRoleController(role)
+	uc := controller.NewUsageController(usage)
+	ic := controller.NewInstructionController(instruction)
+	gc := controller.NewGuildController(guild, quota, usage)
+	auth := controller.NewAuthController(session)
+	mc := controller.NewMembershipController(membership)
 
 	return &ServiceLoader{
-		Acc:     acc,
-		Chat:    chat,
-		Account: account,
-		Prompt:  prompt,
-		Gemini:  gemini,
+		Acc:       acc,
+		Chat:      chat,
+		History:   history,
+		Archive:   arc,
+		Channel:   ch,
+		Role:      rc,
+		Usage:     uc,
+		Inst:      ic,
+		Guild:     gc,
+		Auth:      auth,
+		Member:    mc,
+		Account:   account,
+		Memory:    memory,
+		Prompt:    prompt,
+		Gemini:    gemini,
+		Retention: retention,
+		Reset:     reset,
+		Session:   session,
 	}
 }
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"slices"
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// ChannelMessage is a recent message of a shared channel, including
+// messages of participants which never called the bot.
+type ChannelMessage struct {
+	ChannelID  string `gorm:"index:idx_channel_message"`
+	AuthorID   string
+	AuthorName string
+	Content    string
+	Bot        bool `gorm:"default:false"`
+	Escaped    bool `gorm:"default:false"` // plaintext is escaped, see util.ESCAPE_PREFIX
+	gorm.Model
+}
+
+func (m *ChannelMessage) BeforeSave(tx *gorm.DB) error {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return err
+	}
+
+	m.Escaped = true
+	m.Content, err = ring.Encrypt(m.Content)
+	return err
+}
+
+func (m *ChannelMessage) AfterSave(tx *gorm.DB) error {
+	return m.decrypt()
+}
+
+func (m *ChannelMessage) AfterFind(tx *gorm.DB) error {
+	return m.decrypt()
+}
+
+func (m *ChannelMessage) decrypt() error {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return err
+	}
+
+	m.Content, err = ring.Decrypt(m.Content, m.Escaped)
+	return err
+}
+
+type ChannelRepository interface {
+	Create(msg *ChannelMessage) error
+	Read(cid string, limit int, since time.Time) ([]*ChannelMessage, error)
+	Trim(cid string, keep int) error
+	Flush(cid string) error
+	Rekey(ring *util.Keyring) (int64, error)
+}
+
+type channelRepository struct {
+	db *util.Database
+}
+
+func NewChannelRepository(database *util.Database) ChannelRepository {
+	return &channelRepository{db: database}
+}
+
+func (repo *channelRepository) Create(msg *ChannelMessage) error {
+	return repo.db.GetDB().Create(msg).Error
+}
+
+func (repo *channelRepository) Read(cid string, limit int, since time.Time) ([]*ChannelMessage, error) {
+	var list = make([]*ChannelMessage, 0)
+	err := repo.db.GetDB().Where("channel_id = ? AND created_at >= ?", cid, since).
+		Order("created_at desc").Limit(limit).Find(&list).Error
+
+	slices.Reverse(list)
+	return list, err
+}
+
+// Trim permanently removes everything but the newest keep messages of
+// the channel, the buffer has no use for deleted rows.
+func (repo *channelRepository) Trim(cid string, keep int) error {
+	var ids []uint
+	err := repo.db.GetDB().Model(&ChannelMessage{}).Where("channel_id = ?", cid).
+		Order("created_at desc").Pluck("id", &ids).Error
+	if err != nil || len(ids) <= keep {
+		return err
+	}
+
+	return repo.db.GetDB().Unscoped().Delete(&ChannelMessage{}, ids[keep:]).Error
+}
+
+func (repo *channelRepository) Flush(cid string) error {
+	return repo.db.GetDB().Unscoped().Where("channel_id = ?", cid).Delete(&ChannelMessage{}).Error
+}
+
+// Rekey re-seals every channel message which is not yet stored with the
+// active key of the keyring.
+func (repo *channelRepository) Rekey(ring *util.Keyring) (int64, error) {
+	var count int64
+	var batch []*ChannelMessage
+	raw := repo.db.GetDB().Session(&gorm.Session{SkipHooks: true}).Unscoped()
+
+	err := raw.Model(&ChannelMessage{}).FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for _, m := range batch {
+			if ring.Current(m.Content) {
+				continue
+			}
+
+			content, err := ring.Rotate(m.Content, m.Escaped)
+			if err != nil {
+				return err
+			}
+
+			err = raw.Model(m).UpdateColumns(map[string]any{"content": content, "escaped": true}).Error
+			if err != nil {
+				return err
+			}
+
+			count++
+		}
+
+		return nil
+	}).Error
+
+	return count, err
+}
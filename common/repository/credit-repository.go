@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// CreditEntry records a grant (positive) or spend (negative) of bonus
+// credits together with the balance it left.
+type CreditEntry struct {
+	UserID      string `gorm:"index"`
+	Amount      int
+	Balance     int
+	ModeratorID string
+	Reason      string
+	gorm.Model
+}
+
+type CreditRepository interface {
+	Create(entry *CreditEntry) error
+	Read(uid string) ([]*CreditEntry, error)
+}
+
+type creditRepository struct {
+	db *util.Database
+}
+
+func NewCreditRepository(database *util.Database) CreditRepository {
+	return &creditRepository{db: database}
+}
+
+func (repo *creditRepository) Create(entry *CreditEntry) error {
+	return repo.db.GetDB().Create(entry).Error
+}
+
+func (repo *creditRepository) Read(uid string) ([]*CreditEntry, error) {
+	var list = make([]*CreditEntry, 0)
+	err := repo.db.GetDB().Where("user_id = ?", uid).Order("created_at desc").Find(&list).Error
+
+	return list, err
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// Guild is a Discord server with its own role and a quota pool shared by
+// all of its members.
+type Guild struct {
+	ID             string `gorm:"primarykey"`
+	Name           string
+	RoleID         int
+	Role           *Role      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Count          int        `gorm:"default:0"`
+	TokenCount     int        `gorm:"default:0"`
+	QuotaStartedAt *time.Time `gorm:"index"`
+	gorm.Model
+}
+
+type GuildRepository interface {
+	Create(guild *Guild) error
+	Read(id string) (*Guild, error)
+	Update(guild *Guild) error
+	Delete(id string) error
+	ResetAll() error
+	ResetStarted(before time.Time) (int64, error)
+	AddUsage(id string, count, tokens int, now time.Time) error
+	CountByRole(roleID int) int
+	Reassign(from, to int) error
+}
+
+type guildRepository struct {
+	db *util.Database
+}
+
+func NewGuildRepository(database *util.Database) GuildRepository {
+	return &guildRepository{db: database}
+}
+
+func (repo *guildRepository) Create(guild *Guild) error {
+	return repo.db.GetDB().Create(guild).Error
+}
+
+func (repo *guildRepository) Read(id string) (*Guild, error) {
+	var guild Guild
+	err := repo.db.GetDB().Where("id = ?", id).First(&guild).Error
+
+	return &guild, err
+}
+
+func (repo *guildRepository) Update(guild *Guild) error {
+	return repo.db.GetDB().Save(guild).Error
+}
+
+func (repo *guildRepository) Delete(id string) error {
+	return repo.db.GetDB().Where("id = ?", id).Delete(&Guild{}).Error
+}
+
+func (repo *guildRepository) ResetAll() error {
+	return repo.db.GetDB().Model(&Guild{}).Where("1 = 1").Updates(map[string]any{
+		"count":            0,
+		"token_count":      0,
+		"quota_started_at": nil,
+	}).Error
+}
+
+func (repo *guildRepository) ResetStarted(before time.Time) (int64, error) {
+	tx := repo.db.GetDB().Model(&Guild{}).Where("quota_started_at <= ?", before).Updates(map[string]any{
+		"count":            0,
+		"token_count":      0,
+		"quota_started_at": nil,
+	})
+
+	return tx.RowsAffected, tx.Error
+}
+
+func (repo *guildRepository) AddUsage(id string, count, tokens int, now time.Time) error {
+	return repo.db.GetDB().Model(&Guild{}).Where("id = ?", id).Updates(map[string]any{
+		"count":            gorm.Expr("count + ?", count),
+		"token_count":      gorm.Expr("token_count + ?", tokens),
+		"quota_started_at": gorm.Expr("COALESCE(quota_started_at, ?)", now),
+	}).Error
+}
+
+func (repo *guildRepository) CountByRole(roleID int) int {
+	var count int64
+	repo.db.GetDB().Model(&Guild{}).Where("role_id = ?", roleID).Count(&count)
+
+	return int(count)
+}
+
+func (repo *guildRepository) Reassign(from, to int) error {
+	return repo.db.GetDB().Model(&Guild{}).Where("role_id = ?", from).Update("role_id", to).Error
+}
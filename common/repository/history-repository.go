@@ -1,26 +1,117 @@
 package repository
 
 import (
+	"errors"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/devproje/neko-engine/util"
 	"gorm.io/gorm"
 )
 
 type History struct {
-	UserID  string `gorm:"index:idx_history_index"`
-	User    *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Content string
-	Answer  string
+	UserID          string `gorm:"index:idx_history_index"`
+	User            *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ParentID        *uint  `gorm:"index"`
+	Content         string
+	Answer          string
+	Persona         string
+	ModelName       string `gorm:"column:model"`
+	GuildID         string // guild whose quota pool paid for the exchange
+	ChannelID       string // shared channel the exchange took part in
+	NSFW            bool   `gorm:"default:false"`
+	PromptTokens    int    `gorm:"default:0"`
+	CandidateTokens int    `gorm:"default:0"`
+	TotalTokens     int    `gorm:"default:0"`
+	Latency         int64  // milliseconds
+	FinishReason    string
+	Escaped         bool                 `gorm:"default:false"` // plaintext is escaped, see util.ESCAPE_PREFIX
+	Attachments     []*HistoryAttachment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	gorm.Model
 }
 
+type HistoryAttachment struct {
+	HistoryID   uint `gorm:"index"`
+	URL         string
+	Filename    string
+	ContentType string
+	Size        int64
+	Hash        string
+	gorm.Model
+}
+
+// BeforeSave seals the conversation content before it is written.
+func (h *History) BeforeSave(tx *gorm.DB) error {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return err
+	}
+
+	if h.Content, err = ring.Encrypt(h.Content); err != nil {
+		return err
+	}
+
+	h.Escaped = true
+	h.Answer, err = ring.Encrypt(h.Answer)
+	return err
+}
+
+// AfterSave restores the plaintext so callers never see sealed values.
+func (h *History) AfterSave(tx *gorm.DB) error {
+	return h.decrypt()
+}
+
+func (h *History) AfterFind(tx *gorm.DB) error {
+	return h.decrypt()
+}
+
+func (h *History) decrypt() error {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return err
+	}
+
+	if h.Content, err = ring.Decrypt(h.Content, h.Escaped); err != nil {
+		return err
+	}
+
+	h.Answer, err = ring.Decrypt(h.Answer, h.Escaped)
+	return err
+}
+
+// HistoryHead points to the active leaf of a user's conversation tree.
+// HistoryID is zero while the active branch is empty.
+type HistoryHead struct {
+	UserID    string `gorm:"primaryKey"`
+	HistoryID uint
+	UpdatedAt time.Time
+}
+
 type HistoryRepository interface {
 	Create(history *History) error
 	Read(uid string, limit int) ([]*History, error)
+	ReadAll(uid string) ([]*History, error)
+	ReadOne(uid string, id uint) (*History, error)
+	ReadHead(uid string) (*History, error)
+	ReadBranch(uid string, limit int) ([]*History, error)
+	ReadSiblings(uid string, id uint) ([]*History, error)
+	ReadLeaf(uid string, id uint) (*History, error)
+	ReadPage(uid string, offset, limit int) ([]*History, error)
+	SetHead(uid string, id uint) error
+	Count(uid string) int
+	Delete(uid string, id uint) error
 	PurgeOne(uid string) error
 	PurgeN(uid string, n int) error
 	Flush(uid string) error
+	ExpireBefore(roleID int, before time.Time) (int64, error)
+	Overflowing(roleID int, rows int) ([]string, error)
+	Trim(uid string, rows int) (int64, error)
+	PurgeDeleted(before time.Time) (int64, error)
+	Search(uid, query string, limit int) ([]*History, error)
+	Rekey(ring *util.Keyring) (int64, error)
+	Unlinked() ([]string, error)
+	Chain(uid string) error
 }
 
 type historyRepository struct {
@@ -43,33 +134,442 @@ func (repo *historyRepository) Read(uid string, limit int) ([]*History, error) {
 	return list, err
 }
 
-func (repo *historyRepository) PurgeOne(uid string) error {
+func (repo *historyRepository) ReadAll(uid string) ([]*History, error) {
+	var list = make([]*History, 0)
+	err := repo.db.GetDB().Preload("Attachments").Where("user_id = ?", uid).Order("created_at asc, id asc").Find(&list).Error
+
+	return list, err
+}
+
+func (repo *historyRepository) ReadOne(uid string, id uint) (*History, error) {
 	var history History
-	err := repo.db.GetDB().Where("user_id = ?", uid).Order("created_at desc").Limit(1).First(&history).Error
+	err := repo.db.GetDB().Preload("Attachments").Where("user_id = ?", uid).First(&history, id).Error
+
+	return &history, err
+}
+
+func (repo *historyRepository) ReadHead(uid string) (*History, error) {
+	var head HistoryHead
+	if err := repo.db.GetDB().First(&head, "user_id = ?", uid).Error; err != nil {
+		return nil, err
+	}
+
+	if head.HistoryID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return repo.ReadOne(uid, head.HistoryID)
+}
+
+// ReadBranch walks from the active head up to the root and returns
+// at most limit entries of the active branch in chronological order.
+func (repo *historyRepository) ReadBranch(uid string, limit int) ([]*History, error) {
+	var list = make([]*History, 0)
+	current, err := repo.ReadHead(uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return list, nil
+	}
+
 	if err != nil {
+		return list, err
+	}
+
+	for len(list) < limit {
+		list = append(list, current)
+		if current.ParentID == nil {
+			break
+		}
+
+		current, err = repo.ReadOne(uid, *current.ParentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+
+		if err != nil {
+			return list, err
+		}
+	}
+
+	slices.Reverse(list)
+	return list, nil
+}
+
+func (repo *historyRepository) ReadSiblings(uid string, id uint) ([]*History, error) {
+	history, err := repo.ReadOne(uid, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var list = make([]*History, 0)
+	query := repo.db.GetDB().Preload("Attachments").Where("user_id = ?", uid)
+	if history.ParentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *history.ParentID)
+	}
+
+	err = query.Order("created_at asc").Find(&list).Error
+	return list, err
+}
+
+// ReadLeaf follows the newest child from the given entry until it reaches
+// a leaf, so switching to a branch restores its latest continuation.
+func (repo *historyRepository) ReadLeaf(uid string, id uint) (*History, error) {
+	current, err := repo.ReadOne(uid, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var child History
+		err = repo.db.GetDB().Preload("Attachments").Where("user_id = ? AND parent_id = ?", uid, current.ID).Order("created_at desc").First(&child).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return current, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		current = &child
+	}
+}
+
+func (repo *historyRepository) ReadPage(uid string, offset, limit int) ([]*History, error) {
+	var list = make([]*History, 0)
+	err := repo.db.GetDB().Preload("Attachments").Where("user_id = ?", uid).Order("created_at desc").Offset(offset).Limit(limit).Find(&list).Error
+
+	return list, err
+}
+
+func (repo *historyRepository) SetHead(uid string, id uint) error {
+	return repo.db.GetDB().Save(&HistoryHead{UserID: uid, HistoryID: id}).Error
+}
+
+func (repo *historyRepository) Count(uid string) int {
+	var count int64
+	repo.db.GetDB().Model(&History{}).Where("user_id = ?", uid).Count(&count)
+
+	return int(count)
+}
+
+// moveHead points the head at the nearest ancestor of the deleted entry
+// which still exists if the deleted entry was the active one.
+func (repo *historyRepository) moveHead(uid string, deleted *History) error {
+	var head HistoryHead
+	err := repo.db.GetDB().First(&head, "user_id = ?", uid).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil || head.HistoryID != deleted.ID {
 		return err
 	}
 
-	return repo.db.GetDB().Delete(&history).Error
+	parent := deleted.ParentID
+	for parent != nil {
+		var history History
+		err = repo.db.GetDB().Unscoped().Select("id", "parent_id", "deleted_at").
+			Where("user_id = ?", uid).First(&history, *parent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !history.DeletedAt.Valid {
+			return repo.SetHead(uid, history.ID)
+		}
+
+		parent = history.ParentID
+	}
+
+	return repo.SetHead(uid, 0)
+}
+
+// Delete removes a single entry. Its children are re-parented to the
+// parent of the entry, so the context above it stays reachable from
+// every branch below.
+func (repo *historyRepository) Delete(uid string, id uint) error {
+	return repo.db.Transaction(func(tx *util.Database) error {
+		hist := &historyRepository{db: tx}
+		history, err := hist.ReadOne(uid, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.GetDB().Model(&History{}).Where("user_id = ? AND parent_id = ?", uid, history.ID).
+			Update("parent_id", history.ParentID).Error
+		if err != nil {
+			return err
+		}
+
+		if err = tx.GetDB().Delete(history).Error; err != nil {
+			return err
+		}
+
+		return hist.moveHead(uid, history)
+	})
+}
+
+func (repo *historyRepository) PurgeOne(uid string) error {
+	history, err := repo.ReadHead(uid)
+	if err != nil {
+		return err
+	}
+
+	return repo.Delete(uid, history.ID)
 }
 
 func (repo *historyRepository) PurgeN(uid string, n int) error {
-	var histories []*History
-	err := repo.db.GetDB().Where("user_id = ?", uid).Order("created_at desc").Limit(n).Find(&histories).Error
+	histories, err := repo.ReadBranch(uid, n)
 	if err != nil {
 		return err
 	}
+
 	if len(histories) == 0 {
-		return nil
+		return gorm.ErrRecordNotFound
 	}
+
 	ids := make([]uint, len(histories))
 	for i, h := range histories {
 		ids[i] = h.ID
 	}
 
-	return repo.db.GetDB().Delete(&History{}, ids).Error
+	if err = repo.db.GetDB().Delete(&History{}, ids).Error; err != nil {
+		return err
+	}
+
+	if histories[0].ParentID == nil {
+		return repo.SetHead(uid, 0)
+	}
+
+	return repo.SetHead(uid, *histories[0].ParentID)
 }
 
 func (repo *historyRepository) Flush(uid string) error {
-	return repo.db.GetDB().Where("user_id = ?", uid).Delete(&History{}).Error
+	if err := repo.db.GetDB().Where("user_id = ?", uid).Delete(&History{}).Error; err != nil {
+		return err
+	}
+
+	return repo.SetHead(uid, 0)
+}
+
+func (repo *historyRepository) roleUsers(roleID int) *gorm.DB {
+	return repo.db.GetDB().Model(&User{}).Select("id").Where("role_id = ?", roleID)
+}
+
+// ExpireBefore soft deletes histories created before the given time for
+// every user assigned to the role. Heads pointing at an expired entry are
+// moved to the nearest remaining ancestor.
+func (repo *historyRepository) ExpireBefore(roleID int, before time.Time) (int64, error) {
+	var count int64
+	err := repo.db.Transaction(func(tx *util.Database) error {
+		hist := &historyRepository{db: tx}
+		expired := tx.GetDB().Where("user_id IN (?) AND created_at < ?", hist.roleUsers(roleID), before)
+
+		var heads []*History
+		err := expired.Session(&gorm.Session{}).
+			Where("id IN (?)", tx.GetDB().Model(&HistoryHead{}).Select("history_id")).
+			Find(&heads).Error
+		if err != nil {
+			return err
+		}
+
+		ret := expired.Session(&gorm.Session{}).Delete(&History{})
+		if ret.Error != nil {
+			return ret.Error
+		}
+		count = ret.RowsAffected
+
+		for _, head := range heads {
+			if err = hist.moveHead(head.UserID, head); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Overflowing returns users of the role which have more than rows histories.
+func (repo *historyRepository) Overflowing(roleID int, rows int) ([]string, error) {
+	var list = make([]string, 0)
+	err := repo.db.GetDB().Model(&History{}).
+		Where("user_id IN (?)", repo.roleUsers(roleID)).
+		Group("user_id").Having("COUNT(*) > ?", rows).
+		Pluck("user_id", &list).Error
+
+	return list, err
+}
+
+// Trim keeps the newest rows entries of the user's active branch and soft
+// deletes every other entry, including inactive branches, so the user ends
+// up with at most rows entries. The head is always kept. Without an active
+// branch the newest rows entries of the user are kept.
+func (repo *historyRepository) Trim(uid string, rows int) (int64, error) {
+	branch, err := repo.ReadBranch(uid, rows)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(branch) == 0 {
+		var ids []uint
+		err = repo.db.GetDB().Model(&History{}).Where("user_id = ?", uid).
+			Order("created_at desc").Pluck("id", &ids).Error
+		if err != nil || len(ids) <= rows {
+			return 0, err
+		}
+
+		ret := repo.db.GetDB().Delete(&History{}, ids[rows:])
+		return ret.RowsAffected, ret.Error
+	}
+
+	keep := make([]uint, len(branch))
+	for i, h := range branch {
+		keep[i] = h.ID
+	}
+
+	ret := repo.db.GetDB().Where("user_id = ? AND id NOT IN ?", uid, keep).Delete(&History{})
+	return ret.RowsAffected, ret.Error
+}
+
+// PurgeDeleted permanently removes histories soft deleted before the given time.
+func (repo *historyRepository) PurgeDeleted(before time.Time) (int64, error) {
+	ret := repo.db.GetDB().Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&History{})
+
+	return ret.RowsAffected, ret.Error
+}
+
+// Search finds histories of the user whose message or answer matches
+// query. It uses the full-text index when available and falls back to
+// LIKE matching. Encrypted content can not be searched by the database,
+// so it is matched in memory instead.
+func (repo *historyRepository) Search(uid, query string, limit int) ([]*History, error) {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	if ring.Enabled() {
+		return repo.scan(uid, query, limit)
+	}
+
+	var list = make([]*History, 0)
+	err = repo.db.GetDB().Preload("Attachments").
+		Where("user_id = ? AND MATCH(content, answer) AGAINST (? IN NATURAL LANGUAGE MODE)", uid, query).
+		Limit(limit).Find(&list).Error
+	if err == nil && len(list) > 0 {
+		return list, nil
+	}
+
+	pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(query) + "%"
+	err = repo.db.GetDB().Preload("Attachments").
+		Where("user_id = ? AND (content LIKE ? OR answer LIKE ?)", uid, pattern, pattern).
+		Order("created_at desc").Limit(limit).Find(&list).Error
+
+	return list, err
+}
+
+func (repo *historyRepository) scan(uid, query string, limit int) ([]*History, error) {
+	var list = make([]*History, 0)
+	var batch []*History
+	query = strings.ToLower(query)
+
+	err := repo.db.GetDB().Preload("Attachments").Where("user_id = ?", uid).
+		FindInBatches(&batch, 200, func(_ *gorm.DB, _ int) error {
+			for _, h := range batch {
+				if strings.Contains(strings.ToLower(h.Content), query) || strings.Contains(strings.ToLower(h.Answer), query) {
+					list = append(list, h)
+				}
+			}
+
+			return nil
+		}).Error
+
+	// batches are read in primary key order, keep the newest matches
+	slices.Reverse(list)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list, err
+}
+
+// Rekey re-seals every history row, including deleted ones, which is not
+// yet stored with the active key of the keyring.
+func (repo *historyRepository) Rekey(ring *util.Keyring) (int64, error) {
+	var count int64
+	var batch []*History
+	raw := repo.db.GetDB().Session(&gorm.Session{SkipHooks: true}).Unscoped()
+
+	err := raw.Model(&History{}).FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for _, h := range batch {
+			if ring.Current(h.Content) && ring.Current(h.Answer) {
+				continue
+			}
+
+			content, err := ring.Rotate(h.Content, h.Escaped)
+			if err != nil {
+				return err
+			}
+
+			answer, err := ring.Rotate(h.Answer, h.Escaped)
+			if err != nil {
+				return err
+			}
+
+			err = raw.Model(h).UpdateColumns(map[string]any{
+				"content": content,
+				"answer":  answer,
+				"escaped": true,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			count++
+		}
+
+		return nil
+	}).Error
+
+	return count, err
+}
+
+// Unlinked returns users which still have a flat history without a head.
+func (repo *historyRepository) Unlinked() ([]string, error) {
+	var list = make([]string, 0)
+	err := repo.db.GetDB().Model(&History{}).
+		Where("user_id NOT IN (?)", repo.db.GetDB().Model(&HistoryHead{}).Select("user_id")).
+		Distinct().Pluck("user_id", &list).Error
+
+	return list, err
+}
+
+// Chain links a flat history into a single branch ordered by creation
+// time and points the head at the newest entry.
+func (repo *historyRepository) Chain(uid string) error {
+	var histories []*History
+	err := repo.db.GetDB().Where("user_id = ?", uid).Order("created_at asc").Find(&histories).Error
+	if err != nil || len(histories) == 0 {
+		return err
+	}
+
+	for i := 1; i < len(histories); i++ {
+		if histories[i].ParentID != nil {
+			continue
+		}
+
+		err = repo.db.GetDB().Model(histories[i]).Update("parent_id", histories[i-1].ID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return repo.SetHead(uid, histories[len(histories)-1].ID)
 }
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+)
+
+// Membership caches whether a user is in the official server and which
+// Discord roles they hold there.
+type Membership struct {
+	UserID        string `gorm:"primaryKey"`
+	Member        bool
+	Roles         string // comma separated Discord role IDs
+	Source        string // "report" or "lookup"
+	GrantedRoleID int    `gorm:"default:0"` // engine role granted by the membership
+	CheckedAt     time.Time
+	RetryAt       *time.Time // failed lookups are not retried before this
+}
+
+// RoleIDs returns the Discord role IDs of the member.
+func (m *Membership) RoleIDs() []string {
+	if m.Roles == "" {
+		return []string{}
+	}
+
+	return strings.Split(m.Roles, ",")
+}
+
+type MembershipRepository interface {
+	Read(uid string) (*Membership, error)
+	Save(membership *Membership) error
+}
+
+type membershipRepository struct {
+	db *util.Database
+}
+
+func NewMembershipRepository(database *util.Database) MembershipRepository {
+	return &membershipRepository{db: database}
+}
+
+func (repo *membershipRepository) Read(uid string) (*Membership, error) {
+	var membership Membership
+	err := repo.db.GetDB().Where("user_id = ?", uid).First(&membership).Error
+
+	return &membership, err
+}
+
+func (repo *membershipRepository) Save(membership *Membership) error {
+	return repo.db.GetDB().Save(membership).Error
+}
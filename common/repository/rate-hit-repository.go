@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm/clause"
+)
+
+// RateHit is one provider request of a user, kept for the burst rate
+// limit windows when they are shared between instances.
+type RateHit struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    string    `gorm:"index:idx_rate_hit_user"`
+	CreatedAt time.Time `gorm:"index:idx_rate_hit_user"`
+}
+
+type RateHitRepository interface {
+	Create(hit *RateHit) error
+	ReadSince(uid string, since time.Time) ([]*RateHit, error)
+	Prune(uid string, before time.Time) error
+	Lock(uid string) error
+}
+
+type rateHitRepository struct {
+	db *util.Database
+}
+
+func NewRateHitRepository(database *util.Database) RateHitRepository {
+	return &rateHitRepository{db: database}
+}
+
+func (repo *rateHitRepository) Create(hit *RateHit) error {
+	return repo.db.GetDB().Create(hit).Error
+}
+
+func (repo *rateHitRepository) ReadSince(uid string, since time.Time) ([]*RateHit, error) {
+	var list = make([]*RateHit, 0)
+	err := repo.db.GetDB().Where("user_id = ? AND created_at > ?", uid, since).Order("created_at asc").Find(&list).Error
+
+	return list, err
+}
+
+func (repo *rateHitRepository) Prune(uid string, before time.Time) error {
+	return repo.db.GetDB().Where("user_id = ? AND created_at <= ?", uid, before).Delete(&RateHit{}).Error
+}
+
+// Lock takes a row lock on the user until the surrounding transaction
+// ends, so concurrent instances see each other's hits.
+func (repo *rateHitRepository) Lock(uid string) error {
+	return repo.db.GetDB().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", uid).Take(&User{}).Error
+}
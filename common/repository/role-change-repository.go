@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// RoleChange records who changed a user's role, when and why.
+type RoleChange struct {
+	UserID      string `gorm:"index"`
+	FromRoleID  int
+	ToRoleID    int
+	ModeratorID string
+	Reason      string
+	ExpiresAt   *time.Time
+	gorm.Model
+}
+
+type RoleChangeRepository interface {
+	Create(change *RoleChange) error
+	Read(uid string) ([]*RoleChange, error)
+}
+
+type roleChangeRepository struct {
+	db *util.Database
+}
+
+func NewRoleChangeRepository(database *util.Database) RoleChangeRepository {
+	return &roleChangeRepository{db: database}
+}
+
+func (repo *roleChangeRepository) Create(change *RoleChange) error {
+	return repo.db.GetDB().Create(change).Error
+}
+
+func (repo *roleChangeRepository) Read(uid string) ([]*RoleChange, error) {
+	var list = make([]*RoleChange, 0)
+	err := repo.db.GetDB().Where("user_id = ?", uid).Order("created_at desc").Find(&list).Error
+
+	return list, err
+}
@@ -6,15 +6,22 @@ import (
 )
 
 type Role struct {
-	Id    int    `gorm:"primaryKey"`
-	Name  string `gorm:"index"`
-	Limit int
+	Id            int    `gorm:"primaryKey"`
+	Name          string `gorm:"index"`
+	Limit         int
+	TokenLimit    int  `gorm:"default:0"`     // daily token budget, 0 disables it
+	MinuteLimit   int  `gorm:"default:0"`     // requests per minute, 0 disables it
+	HourLimit     int  `gorm:"default:0"`     // requests per hour, 0 disables it
+	PromptLimit   int  `gorm:"not null"`      // custom instruction length, 0 disables them
+	EphemeralFree bool `gorm:"default:false"` // ephemeral chats do not count against Limit
 	gorm.Model
 }
 
 type RoleRepository interface {
 	Create(role *Role) error
 	Read(id int) (*Role, error)
+	ReadByName(name string) (*Role, error)
+	List() ([]*Role, error)
 	Update(role *Role) error
 	Delete(id int) error
 	Count() int
@@ -39,6 +46,20 @@ func (repo *roleRepository) Read(id int) (*Role, error) {
 	return &role, err
 }
 
+func (repo *roleRepository) ReadByName(name string) (*Role, error) {
+	var role Role
+	err := repo.db.GetDB().Where("name = ?", name).First(&role).Error
+
+	return &role, err
+}
+
+func (repo *roleRepository) List() ([]*Role, error) {
+	var list = make([]*Role, 0)
+	err := repo.db.GetDB().Order("id asc").Find(&list).Error
+
+	return list, err
+}
+
 func (repo *roleRepository) Update(role *Role) error {
 	return repo.db.GetDB().Save(role).Error
 }
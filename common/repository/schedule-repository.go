@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm/clause"
+)
+
+// Schedule persists the last run of a scheduled job and the lease of the
+// instance currently running it.
+type Schedule struct {
+	Name       string `gorm:"primaryKey;size:64"`
+	LastRun    *time.Time
+	Holder     string
+	LeaseUntil time.Time
+}
+
+type ScheduleRepository interface {
+	Read(name string) (*Schedule, error)
+	Acquire(name, holder string, now, until time.Time) (bool, error)
+	Release(name, holder string, now time.Time) error
+	SetLastRun(name string, last time.Time) error
+}
+
+type scheduleRepository struct {
+	db *util.Database
+}
+
+func NewScheduleRepository(database *util.Database) ScheduleRepository {
+	return &scheduleRepository{db: database}
+}
+
+func (repo *scheduleRepository) Read(name string) (*Schedule, error) {
+	var schedule Schedule
+	err := repo.db.GetDB().Where("name = ?", name).First(&schedule).Error
+
+	return &schedule, err
+}
+
+// Acquire takes the lease of the job until the given time. It fails if
+// another holder owns a lease that has not expired yet.
+func (repo *scheduleRepository) Acquire(name, holder string, now, until time.Time) (bool, error) {
+	tx := repo.db.GetDB().Model(&Schedule{}).
+		Where("name = ? AND (holder = ? OR lease_until < ?)", name, holder, now).
+		Updates(map[string]any{"holder": holder, "lease_until": until})
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	if tx.RowsAffected > 0 {
+		return true, nil
+	}
+
+	tx = repo.db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&Schedule{
+		Name:       name,
+		Holder:     holder,
+		LeaseUntil: until,
+	})
+
+	return tx.RowsAffected > 0, tx.Error
+}
+
+func (repo *scheduleRepository) Release(name, holder string, now time.Time) error {
+	return repo.db.GetDB().Model(&Schedule{}).
+		Where("name = ? AND holder = ?", name, holder).
+		Updates(map[string]any{"holder": "", "lease_until": now}).Error
+}
+
+func (repo *scheduleRepository) SetLastRun(name string, last time.Time) error {
+	return repo.db.GetDB().Model(&Schedule{}).Where("name = ?", name).Update("last_run", last).Error
+}
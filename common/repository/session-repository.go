@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// Session is a login of the public API. Only the SHA-256 hash of the
+// opaque token is stored.
+type Session struct {
+	TokenHash string `gorm:"uniqueIndex;size:64"`
+	UserID    string `gorm:"index"`
+	UserAgent string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	gorm.Model
+}
+
+type SessionRepository interface {
+	Create(session *Session) error
+	ReadByHash(hash string) (*Session, error)
+	List(uid string, now time.Time) ([]*Session, error)
+	Revoke(uid string, id uint, now time.Time) (bool, error)
+}
+
+type sessionRepository struct {
+	db *util.Database
+}
+
+func NewSessionRepository(database *util.Database) SessionRepository {
+	return &sessionRepository{db: database}
+}
+
+func (repo *sessionRepository) Create(session *Session) error {
+	return repo.db.GetDB().Create(session).Error
+}
+
+func (repo *sessionRepository) ReadByHash(hash string) (*Session, error) {
+	var session Session
+	err := repo.db.GetDB().Where("token_hash = ?", hash).First(&session).Error
+
+	return &session, err
+}
+
+// List returns the sessions of the user that are neither expired nor revoked.
+func (repo *sessionRepository) List(uid string, now time.Time) ([]*Session, error) {
+	var list = make([]*Session, 0)
+	err := repo.db.GetDB().Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", uid, now).
+		Order("created_at desc").Find(&list).Error
+
+	return list, err
+}
+
+func (repo *sessionRepository) Revoke(uid string, id uint, now time.Time) (bool, error) {
+	tx := repo.db.GetDB().Model(&Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, uid).
+		Update("revoked_at", now)
+
+	return tx.RowsAffected > 0, tx.Error
+}
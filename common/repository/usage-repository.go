@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+const (
+	USAGE_OK    = "ok"
+	USAGE_ERROR = "error"
+
+	USAGE_CHAT     = "chat"
+	USAGE_AFFINITY = "affinity"
+)
+
+// Usage is one provider call, kept even if the chat itself is ephemeral
+// or its history is deleted later.
+type Usage struct {
+	UserID          string `gorm:"index"`
+	RoleID          int    `gorm:"index"`
+	GuildID         string `gorm:"index"`
+	Pooled          bool   // charged to the quota pool of the guild
+	Persona         string `gorm:"index"`
+	ModelName       string `gorm:"column:model;index"`
+	PromptTokens    int
+	CandidateTokens int
+	ThoughtsTokens  int
+	CachedTokens    int
+	TotalTokens     int
+	Latency         int64 // milliseconds
+	Cost            float64
+	Status          string
+	Purpose         string `gorm:"index;default:chat"` // USAGE_CHAT or an internal call like USAGE_AFFINITY
+	gorm.Model
+}
+
+// UsageSummary aggregates the usage rows sharing the same key.
+type UsageSummary struct {
+	Key             string  `json:"key"`
+	Requests        int64   `json:"requests"`
+	Failed          int64   `json:"failed"`
+	PromptTokens    int64   `json:"prompt_tokens"`
+	CandidateTokens int64   `json:"candidate_tokens"`
+	TotalTokens     int64   `json:"total_tokens"`
+	Cost            float64 `json:"cost"`
+	Latency         float64 `json:"latency"`
+}
+
+// UsageFilter narrows an aggregation. Empty fields are not filtered.
+type UsageFilter struct {
+	From    time.Time
+	To      time.Time
+	UserID  string
+	GuildID string
+}
+
+type UsageRepository interface {
+	Create(usage *Usage) error
+	Aggregate(column string, filter *UsageFilter) ([]*UsageSummary, error)
+	SumCost(from, to time.Time) (float64, error)
+}
+
+type usageRepository struct {
+	db *util.Database
+}
+
+func NewUsageRepository(database *util.Database) UsageRepository {
+	return &usageRepository{db: database}
+}
+
+func (repo *usageRepository) Create(usage *Usage) error {
+	return repo.db.GetDB().Create(usage).Error
+}
+
+// Aggregate groups the usage rows by the given SQL expression. column must
+// never come from user input.
+func (repo *usageRepository) Aggregate(column string, filter *UsageFilter) ([]*UsageSummary, error) {
+	var list = make([]*UsageSummary, 0)
+	tx := repo.db.GetDB().Model(&Usage{}).Select(fmt.Sprintf(`%s AS `+"`key`"+`,
+		COUNT(*) AS requests,
+		SUM(CASE WHEN status = ? THEN 0 ELSE 1 END) AS failed,
+		SUM(prompt_tokens) AS prompt_tokens,
+		SUM(candidate_tokens) AS candidate_tokens,
+		SUM(total_tokens) AS total_tokens,
+		SUM(cost) AS cost,
+		AVG(latency) AS latency`, column), USAGE_OK)
+
+	if !filter.From.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		tx = tx.Where("created_at < ?", filter.To)
+	}
+
+	if filter.UserID != "" {
+		tx = tx.Where("user_id = ?", filter.UserID)
+	}
+
+	if filter.GuildID != "" {
+		tx = tx.Where("guild_id = ?", filter.GuildID)
+	}
+
+	err := tx.Group("`key`").Order("`key` asc").Scan(&list).Error
+	return list, err
+}
+
+func (repo *usageRepository) SumCost(from, to time.Time) (float64, error) {
+	var cost float64
+	err := repo.db.GetDB().Model(&Usage{}).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Select("COALESCE(SUM(cost), 0)").Scan(&cost).Error
+
+	return cost, err
+}
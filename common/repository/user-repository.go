@@ -1,20 +1,32 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/devproje/neko-engine/util"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        string `gorm:"primarykey"`
-	Username  string `gorm:"index"`
-	Prompt    string
-	RoleID    int
-	Role      *Role `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Count     int   `gorm:"default:0"`
-	Total     int   `gorm:"default:0"`
-	Sentiment int   `gorm:"default:0"`
-	Banned    bool  `gorm:"default:false"`
+	ID              string `gorm:"primarykey"`
+	Username        string `gorm:"index"`
+	Prompt          string
+	RoleID          int
+	Role            *Role      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	RoleExpiresAt   *time.Time `gorm:"index"`
+	FallbackRoleID  int        `gorm:"default:0"` // role restored once RoleExpiresAt has passed
+	Count           int        `gorm:"default:0"`
+	TokenCount      int        `gorm:"default:0"`
+	QuotaStartedAt  *time.Time `gorm:"index"` // first counted chat since the last reset
+	Total           int        `gorm:"default:0"`
+	Credits         int        `gorm:"default:0"` // bonus chats, spent once the daily limit is reached
+	DefaultPersona  string     // persona used when a chat names none
+	PreferEphemeral bool       `gorm:"default:false"`
+	Sentiment       int        `gorm:"default:0"`
+	Banned          bool       `gorm:"default:false"`
+	BanReason       string
+	BannedBy        string
+	BanExpiresAt    *time.Time `gorm:"index"`
 	gorm.Model
 }
 
@@ -22,8 +34,18 @@ type UserRepository interface {
 	Create(usr *User) error
 	Read(id string) (*User, error)
 	Update(usr *User) error
+	Patch(id string, fields map[string]any) error
 	Delete(id string) error
 	ResetAll() error
+	ResetStarted(before time.Time) (int64, error)
+	AddUsage(id string, count, tokens int, now time.Time) error
+	IncreaseTotal(id string) error
+	AddCredits(id string, amount int) (bool, error)
+	AddSentiment(id string, delta, low, high int) error
+	CountByRole(roleID int) int
+	Reassign(from, to int) error
+	ReadExpiredRoles(now time.Time) ([]*User, error)
+	ReadExpiredBans(now time.Time) ([]*User, error)
 }
 
 type userRepository struct {
@@ -49,10 +71,94 @@ func (repo *userRepository) Update(usr *User) error {
 	return repo.db.GetDB().Save(usr).Error
 }
 
+// Patch updates only the given columns, so counters changed concurrently
+// by other requests are not overwritten.
+func (repo *userRepository) Patch(id string, fields map[string]any) error {
+	return repo.db.GetDB().Model(&User{}).Where("id = ?", id).Updates(fields).Error
+}
+
 func (repo *userRepository) Delete(id string) error {
 	return repo.db.GetDB().Delete(&User{}, id).Error
 }
 
 func (repo *userRepository) ResetAll() error {
-	return repo.db.GetDB().Model(&User{}).Update("count", 0).Error
+	return repo.db.GetDB().Model(&User{}).Where("1 = 1").Updates(map[string]any{
+		"count":            0,
+		"token_count":      0,
+		"quota_started_at": nil,
+	}).Error
+}
+
+// ResetStarted resets the usage of users whose quota window started at
+// or before the given time.
+func (repo *userRepository) ResetStarted(before time.Time) (int64, error) {
+	tx := repo.db.GetDB().Model(&User{}).Where("quota_started_at <= ?", before).Updates(map[string]any{
+		"count":            0,
+		"token_count":      0,
+		"quota_started_at": nil,
+	})
+
+	return tx.RowsAffected, tx.Error
+}
+
+func (repo *userRepository) AddUsage(id string, count, tokens int, now time.Time) error {
+	return repo.db.GetDB().Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"count":            gorm.Expr("count + ?", count),
+		"token_count":      gorm.Expr("token_count + ?", tokens),
+		"quota_started_at": gorm.Expr("COALESCE(quota_started_at, ?)", now),
+	}).Error
+}
+
+func (repo *userRepository) IncreaseTotal(id string) error {
+	return repo.db.GetDB().Model(&User{}).Where("id = ?", id).Update("total", gorm.Expr("total + 1")).Error
+}
+
+// AddSentiment moves the sentiment of the user by delta, clamped to the
+// range low to high.
+func (repo *userRepository) AddSentiment(id string, delta, low, high int) error {
+	return repo.db.GetDB().Model(&User{}).Where("id = ?", id).
+		Update("sentiment", gorm.Expr("LEAST(GREATEST(sentiment + ?, ?), ?)", delta, low, high)).Error
+}
+
+// AddCredits changes the credit balance of the user. It reports false if
+// the balance would drop below zero, leaving it untouched.
+func (repo *userRepository) AddCredits(id string, amount int) (bool, error) {
+	tx := repo.db.GetDB().Model(&User{}).Where("id = ? AND credits + ? >= 0", id, amount).
+		Update("credits", gorm.Expr("credits + ?", amount))
+
+	return tx.RowsAffected > 0, tx.Error
+}
+
+// CountByRole counts the users assigned to the role, including users who
+// fall back to it once their temporary role expires.
+func (repo *userRepository) CountByRole(roleID int) int {
+	var count int64
+	repo.db.GetDB().Model(&User{}).Where("role_id = ? OR fallback_role_id = ?", roleID, roleID).Count(&count)
+
+	return int(count)
+}
+
+// Reassign moves users from one role to another, both as their current
+// and as their fallback role.
+func (repo *userRepository) Reassign(from, to int) error {
+	err := repo.db.GetDB().Model(&User{}).Where("role_id = ?", from).Update("role_id", to).Error
+	if err != nil {
+		return err
+	}
+
+	return repo.db.GetDB().Model(&User{}).Where("fallback_role_id = ?", from).Update("fallback_role_id", to).Error
+}
+
+func (repo *userRepository) ReadExpiredRoles(now time.Time) ([]*User, error) {
+	var list = make([]*User, 0)
+	err := repo.db.GetDB().Where("role_expires_at IS NOT NULL AND role_expires_at <= ?", now).Find(&list).Error
+
+	return list, err
+}
+
+func (repo *userRepository) ReadExpiredBans(now time.Time) ([]*User, error) {
+	var list = make([]*User, 0)
+	err := repo.db.GetDB().Where("banned = ? AND ban_expires_at IS NOT NULL AND ban_expires_at <= ?", true, now).Find(&list).Error
+
+	return list, err
 }
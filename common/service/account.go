@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/devproje/neko-engine/common/repository"
 	"github.com/devproje/neko-engine/util"
@@ -22,14 +23,24 @@ func init() {
 	}
 	defer db.Close()
 
-	db.GetDB().AutoMigrate(&repository.Role{}, &repository.User{})
+	// roles created before custom instructions existed get the default
+	// length, 0 is kept for roles that turned them off afterwards
+	promptLimit := db.GetDB().Migrator().HasColumn(&repository.Role{}, "PromptLimit")
+	db.GetDB().AutoMigrate(&repository.Role{}, &repository.User{}, &repository.RoleChange{})
+	if !promptLimit {
+		err := db.GetDB().Model(&repository.Role{}).Where("1 = 1").Update("prompt_limit", ROLE_PROMPT_LIMIT_DEFAULT).Error
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
 	role := repository.NewRoleRepository(db)
 	role.Count()
 
 	roles := []*repository.Role{
 		{Id: 1, Name: "root", Limit: -1},
-		{Id: 2, Name: "user", Limit: 80},
-		{Id: 3, Name: "server", Limit: 120},
+		{Id: 2, Name: "user", Limit: 80, PromptLimit: ROLE_PROMPT_LIMIT_DEFAULT},
+		{Id: 3, Name: "server", Limit: 120, PromptLimit: ROLE_PROMPT_LIMIT_DEFAULT},
 	}
 
 	if role.Count() > 0 {
@@ -83,10 +94,24 @@ func (*AccountService) ReadUser(id string) (*repository.User, error) {
 		return nil, err
 	}
 
+	if ret.RoleExpiresAt != nil && !ret.RoleExpiresAt.After(time.Now()) {
+		if err = revertRole(db, ret); err != nil {
+			return nil, err
+		}
+	}
+
+	if ret.Banned && ret.BanExpiresAt != nil && !ret.BanExpiresAt.After(time.Now()) {
+		if err = liftBan(db, ret); err != nil {
+			return nil, err
+		}
+	}
+
 	return ret, nil
 }
 
-func (*AccountService) UpdateUser(usr *repository.User) error {
+// PatchUser updates only the given columns of the user, so counters and
+// balances changed by concurrent chats are kept.
+func (*AccountService) PatchUser(id string, fields map[string]any) error {
 	db := util.NewDatabase()
 	if err := db.Open(); err != nil {
 		return err
@@ -94,11 +119,7 @@ func (*AccountService) UpdateUser(usr *repository.User) error {
 	defer db.Close()
 
 	user := repository.NewUserRepository(db)
-	if err := user.Update(usr); err != nil {
-		return err
-	}
-
-	return nil
+	return user.Patch(id, fields)
 }
 
 func (*AccountService) IncreaseCount(usr *repository.User) error {
@@ -159,3 +180,232 @@ func (as *AccountService) GetRoleById(id int) (*repository.Role, error) {
 
 	return role.Read(id)
 }
+
+// revertRole restores the role a user had before a temporary assignment.
+func revertRole(db *util.Database, usr *repository.User) error {
+	user := repository.NewUserRepository(db)
+	changes := repository.NewRoleChangeRepository(db)
+
+	from := usr.RoleID
+	usr.RoleID = usr.FallbackRoleID
+	if usr.RoleID == 0 {
+		usr.RoleID = ROLE_DEFAULT
+	}
+
+	usr.Role = nil
+	usr.RoleExpiresAt = nil
+	usr.FallbackRoleID = 0
+	err := user.Patch(usr.ID, map[string]any{
+		"role_id":          usr.RoleID,
+		"role_expires_at":  nil,
+		"fallback_role_id": 0,
+	})
+	if err != nil {
+		return err
+	}
+
+	return changes.Create(&repository.RoleChange{
+		UserID:      usr.ID,
+		FromRoleID:  from,
+		ToRoleID:    usr.RoleID,
+		ModeratorID: "system",
+		Reason:      "temporary role expired",
+	})
+}
+
+// AssignRole changes the role of a user. If expiresAt is set the current
+// role is restored automatically once it has passed.
+func (*AccountService) AssignRole(id string, roleID int, moderator, reason string, expiresAt *time.Time) (*repository.User, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var usr *repository.User
+	err := db.Transaction(func(tx *util.Database) error {
+		var err error
+		usr, err = assignRole(tx, id, roleID, moderator, reason, expiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// assignRole changes the role of a user and records the change on db, so
+// callers can run it inside their own transaction.
+func assignRole(db *util.Database, id string, roleID int, moderator, reason string, expiresAt *time.Time) (*repository.User, error) {
+	user := repository.NewUserRepository(db)
+	role := repository.NewRoleRepository(db)
+	changes := repository.NewRoleChangeRepository(db)
+
+	usr, err := user.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = role.Read(roleID); err != nil {
+		return nil, err
+	}
+
+	from := usr.RoleID
+	if expiresAt == nil {
+		usr.RoleExpiresAt = nil
+		usr.FallbackRoleID = 0
+	} else {
+		// stacking temporary roles keeps the original permanent role
+		if usr.RoleExpiresAt == nil {
+			usr.FallbackRoleID = usr.RoleID
+		}
+
+		usr.RoleExpiresAt = expiresAt
+	}
+
+	usr.RoleID = roleID
+	usr.Role = nil
+	err = user.Patch(usr.ID, map[string]any{
+		"role_id":          usr.RoleID,
+		"role_expires_at":  usr.RoleExpiresAt,
+		"fallback_role_id": usr.FallbackRoleID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = changes.Create(&repository.RoleChange{
+		UserID:      usr.ID,
+		FromRoleID:  from,
+		ToRoleID:    roleID,
+		ModeratorID: moderator,
+		Reason:      reason,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+func (*AccountService) RoleChanges(id string) ([]*repository.RoleChange, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	changes := repository.NewRoleChangeRepository(db)
+	return changes.Read(id)
+}
+
+// RevertExpiredRoles restores every temporary role which has expired.
+func (*AccountService) RevertExpiredRoles() (int, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	expired, err := user.ReadExpiredRoles(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for i, usr := range expired {
+		if err = revertRole(db, usr); err != nil {
+			return i, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+func liftBan(db *util.Database, usr *repository.User) error {
+	user := repository.NewUserRepository(db)
+	usr.Banned = false
+	usr.BanReason = ""
+	usr.BannedBy = ""
+	usr.BanExpiresAt = nil
+
+	return user.Patch(usr.ID, map[string]any{
+		"banned":         false,
+		"ban_reason":     "",
+		"banned_by":      "",
+		"ban_expires_at": nil,
+	})
+}
+
+// Ban blocks a user from every user facing endpoint. The ban lifts
+// automatically once expiresAt has passed, or never if it is nil.
+func (*AccountService) Ban(id, moderator, reason string, expiresAt *time.Time) (*repository.User, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	usr, err := user.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	usr.Banned = true
+	usr.BanReason = reason
+	usr.BannedBy = moderator
+	usr.BanExpiresAt = expiresAt
+	err = user.Patch(usr.ID, map[string]any{
+		"banned":         true,
+		"ban_reason":     reason,
+		"banned_by":      moderator,
+		"ban_expires_at": expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+func (*AccountService) Unban(id string) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	usr, err := user.Read(id)
+	if err != nil {
+		return err
+	}
+
+	return liftBan(db, usr)
+}
+
+// LiftExpiredBans removes every temporary ban which has expired.
+func (*AccountService) LiftExpiredBans() (int, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	expired, err := user.ReadExpiredBans(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for i, usr := range expired {
+		if err = liftBan(db, usr); err != nil {
+			return i, err
+		}
+	}
+
+	return len(expired), nil
+}
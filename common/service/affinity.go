@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+)
+
+const (
+	AFFINITY_HEURISTIC = "heuristic"
+	AFFINITY_MODEL     = "model"
+
+	AFFINITY_MIN_DEFAULT = -100
+	AFFINITY_MAX_DEFAULT = 100
+
+	// AFFINITY_WORKERS limits the model scorings running at once. Exchanges
+	// observed while all workers are busy are scored by the heuristic.
+	AFFINITY_WORKERS = 4
+)
+
+var (
+	affinityPositive = []string{
+		"thank", "thx", "love", "great", "awesome", "nice", "cute", "happy", "glad", "lol",
+		"고마워", "감사", "좋아", "사랑", "최고", "귀여", "행복", "ㅋㅋ",
+	}
+	affinityNegative = []string{
+		"hate", "stupid", "idiot", "useless", "shut up", "annoying", "dumb", "worst",
+		"싫어", "바보", "멍청", "닥쳐", "짜증", "쓸모없", "최악",
+	}
+)
+
+type AffinityService struct {
+	Gemini  *GeminiService
+	Usage   *UsageService
+	Pricing *PricingService
+	workers chan struct{}
+}
+
+func NewAffinityService(gemini *GeminiService, usage *UsageService, pricing *PricingService) *AffinityService {
+	return &AffinityService{
+		Gemini:  gemini,
+		Usage:   usage,
+		Pricing: pricing,
+		workers: make(chan struct{}, AFFINITY_WORKERS),
+	}
+}
+
+func (*AffinityService) Enabled() bool {
+	return config.Load().Affinity.Enabled
+}
+
+func clampDelta(delta, limit int) int {
+	if limit <= 0 {
+		return delta
+	}
+
+	return max(min(delta, limit), -limit)
+}
+
+// heuristicScore rates the user's message by friendly and hostile words.
+// A plain exchange without hostile words still counts as a small plus.
+func heuristicScore(content string) int {
+	content = strings.ToLower(content)
+	positive, negative := 0, 0
+	for _, word := range affinityPositive {
+		if strings.Contains(content, word) {
+			positive++
+		}
+	}
+
+	for _, word := range affinityNegative {
+		if strings.Contains(content, word) {
+			negative++
+		}
+	}
+
+	if negative == 0 {
+		return positive + 1
+	}
+
+	return positive - negative
+}
+
+// modelScore asks the scorer model to rate the exchange. The call is
+// written to the usage ledger and skipped once a spend cap is reached.
+func (as *AffinityService) modelScore(cnf config.AffinityConfig, uid string, roleID int, content, answer string) (int, error) {
+	model, err := as.Pricing.Model(cnf.Model)
+	if err != nil {
+		return 0, err
+	}
+
+	// a downgraded model means the cap is reached, scoring is not worth it
+	if model != cnf.Model {
+		return 0, ErrSpendCap
+	}
+
+	system := fmt.Sprintf("Rate how the user treated the assistant in this exchange as a single integer "+
+		"from -%d (hostile) to %d (very friendly). Reply with the integer only.", cnf.MaxDelta, cnf.MaxDelta)
+
+	started := time.Now()
+	text, usage, err := as.Gemini.Generate(system, model, fmt.Sprintf("user: %s\nassistant: %s", content, answer))
+
+	ledger := &repository.Usage{
+		UserID:    uid,
+		RoleID:    roleID,
+		ModelName: model,
+		Latency:   time.Since(started).Milliseconds(),
+		Status:    repository.USAGE_OK,
+		Purpose:   repository.USAGE_AFFINITY,
+	}
+
+	if err != nil {
+		ledger.Status = repository.USAGE_ERROR
+	} else if usage != nil {
+		ledger.PromptTokens = int(usage.PromptTokenCount)
+		ledger.CandidateTokens = int(usage.CandidatesTokenCount)
+		ledger.ThoughtsTokens = int(usage.ThoughtsTokenCount)
+		ledger.CachedTokens = int(usage.CachedContentTokenCount)
+		ledger.TotalTokens = int(usage.TotalTokenCount)
+		ledger.Cost = as.Pricing.Cost(model, usage)
+	}
+
+	if err := as.Usage.Record(ledger); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(text))
+}
+
+// score rates one exchange and returns how far the affinity moves. The
+// model scorer is only used if useModel is set.
+func (as *AffinityService) score(uid string, roleID int, content, answer string, useModel bool) int {
+	cnf := config.Load().Affinity
+	if useModel {
+		if delta, err := as.modelScore(cnf, uid, roleID, content, answer); err == nil {
+			return clampDelta(delta, cnf.MaxDelta)
+		}
+	}
+
+	return clampDelta(heuristicScore(content), cnf.MaxDelta)
+}
+
+// affinityRange returns the configured affinity bounds, or the defaults if
+// they are not a valid range.
+func affinityRange(cnf config.AffinityConfig) (int, int) {
+	if cnf.Min >= cnf.Max {
+		return AFFINITY_MIN_DEFAULT, AFFINITY_MAX_DEFAULT
+	}
+
+	return cnf.Min, cnf.Max
+}
+
+func (as *AffinityService) apply(uid string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+
+	cnf := config.Load().Affinity
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	low, high := affinityRange(cnf)
+	user := repository.NewUserRepository(db)
+	return user.AddSentiment(uid, delta, low, high)
+}
+
+// Observe scores an exchange and applies it to the user's affinity. Model
+// scoring runs in the background on one of AFFINITY_WORKERS workers, the
+// heuristic is applied right away.
+func (as *AffinityService) Observe(uid string, roleID int, content, answer string) {
+	cnf := config.Load().Affinity
+	if cnf.Scorer == AFFINITY_MODEL && cnf.Model != "" {
+		select {
+		case as.workers <- struct{}{}:
+			go func() {
+				defer func() { <-as.workers }()
+				if err := as.apply(uid, as.score(uid, roleID, content, answer, true)); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+				}
+			}()
+			return
+		default:
+		}
+	}
+
+	if err := as.apply(uid, as.score(uid, roleID, content, answer, false)); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
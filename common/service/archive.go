@@ -0,0 +1,360 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+// ARCHIVE_VERSION 2 added the preferences, credits and credit ledger.
+const ARCHIVE_VERSION = 2
+
+var (
+	ErrArchiveVersion = errors.New("unsupported archive version")
+	ErrArchiveExists  = errors.New("target account already has chat history")
+)
+
+type ArchiveService struct{}
+
+type Archive struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	User       ArchiveUser       `json:"user"`
+	Role       *ArchiveRole      `json:"role"`
+	Head       uint              `json:"head"`
+	Histories  []*ArchiveHistory `json:"histories"`
+	Credits    []*ArchiveCredit  `json:"credits"`
+}
+
+type ArchiveUser struct {
+	ID              string    `json:"id"`
+	Username        string    `json:"username"`
+	Prompt          string    `json:"prompt"`
+	RoleID          int       `json:"role_id"`
+	Count           int       `json:"count"`
+	Total           int       `json:"total"`
+	Credits         int       `json:"credits"`
+	DefaultPersona  string    `json:"default_persona"`
+	PreferEphemeral bool      `json:"prefer_ephemeral"`
+	Sentiment       int       `json:"sentiment"`
+	Banned          bool      `json:"banned"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ArchiveCredit struct {
+	Amount      int       `json:"amount"`
+	Balance     int       `json:"balance"`
+	ModeratorID string    `json:"moderator_id"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ArchiveRole struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+type ArchiveHistory struct {
+	ID              uint                 `json:"id"`
+	ParentID        *uint                `json:"parent_id"`
+	Content         string               `json:"content"`
+	Answer          string               `json:"answer"`
+	Persona         string               `json:"persona"`
+	Model           string               `json:"model"`
+	NSFW            bool                 `json:"nsfw"`
+	PromptTokens    int                  `json:"prompt_tokens"`
+	CandidateTokens int                  `json:"candidate_tokens"`
+	TotalTokens     int                  `json:"total_tokens"`
+	Latency         int64                `json:"latency"`
+	FinishReason    string               `json:"finish_reason"`
+	Attachments     []*ArchiveAttachment `json:"attachments"`
+	CreatedAt       time.Time            `json:"created_at"`
+}
+
+type ArchiveAttachment struct {
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Hash        string `json:"hash"`
+}
+
+func NewArchiveService() *ArchiveService {
+	return &ArchiveService{}
+}
+
+func (*ArchiveService) Export(uid string) (*Archive, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	role := repository.NewRoleRepository(db)
+	hist := repository.NewHistoryRepository(db)
+	credit := repository.NewCreditRepository(db)
+
+	usr, err := user.Read(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := Archive{
+		Version:    ARCHIVE_VERSION,
+		ExportedAt: time.Now(),
+		User: ArchiveUser{
+			ID:              usr.ID,
+			Username:        usr.Username,
+			Prompt:          usr.Prompt,
+			RoleID:          usr.RoleID,
+			Count:           usr.Count,
+			Total:           usr.Total,
+			Credits:         usr.Credits,
+			DefaultPersona:  usr.DefaultPersona,
+			PreferEphemeral: usr.PreferEphemeral,
+			Sentiment:       usr.Sentiment,
+			Banned:          usr.Banned,
+			CreatedAt:       usr.CreatedAt,
+		},
+		Histories: make([]*ArchiveHistory, 0),
+		Credits:   make([]*ArchiveCredit, 0),
+	}
+
+	if r, err := role.Read(usr.RoleID); err == nil {
+		archive.Role = &ArchiveRole{ID: r.Id, Name: r.Name, Limit: r.Limit}
+	}
+
+	if head, err := hist.ReadHead(uid); err == nil {
+		archive.Head = head.ID
+	}
+
+	histories, err := hist.ReadAll(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range histories {
+		entry := ArchiveHistory{
+			ID:              h.ID,
+			ParentID:        h.ParentID,
+			Content:         h.Content,
+			Answer:          h.Answer,
+			Persona:         h.Persona,
+			Model:           h.ModelName,
+			NSFW:            h.NSFW,
+			PromptTokens:    h.PromptTokens,
+			CandidateTokens: h.CandidateTokens,
+			TotalTokens:     h.TotalTokens,
+			Latency:         h.Latency,
+			FinishReason:    h.FinishReason,
+			Attachments:     make([]*ArchiveAttachment, 0, len(h.Attachments)),
+			CreatedAt:       h.CreatedAt,
+		}
+
+		for _, attach := range h.Attachments {
+			entry.Attachments = append(entry.Attachments, &ArchiveAttachment{
+				URL:         attach.URL,
+				Filename:    attach.Filename,
+				ContentType: attach.ContentType,
+				Size:        attach.Size,
+				Hash:        attach.Hash,
+			})
+		}
+
+		archive.Histories = append(archive.Histories, &entry)
+	}
+
+	ledger, err := credit.Read(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ledger is read newest first, archives keep it in order
+	for i := len(ledger) - 1; i >= 0; i-- {
+		archive.Credits = append(archive.Credits, &ArchiveCredit{
+			Amount:      ledger[i].Amount,
+			Balance:     ledger[i].Balance,
+			ModeratorID: ledger[i].ModeratorID,
+			Reason:      ledger[i].Reason,
+			CreatedAt:   ledger[i].CreatedAt,
+		})
+	}
+
+	return &archive, nil
+}
+
+// Import restores an archive into the account uid. If uid is empty the
+// archived account ID is used. Existing chat history of the target is only
+// replaced when overwrite is set. Credits, affinity and the lifetime total
+// can be forged in an archive like any other field, so they are only
+// restored when trusted is set by an operator who trusts the archive.
+func (*ArchiveService) Import(uid string, archive *Archive, overwrite, trusted bool) error {
+	if archive.Version < 1 || archive.Version > ARCHIVE_VERSION {
+		return fmt.Errorf("%w: %d", ErrArchiveVersion, archive.Version)
+	}
+
+	if uid == "" {
+		uid = archive.User.ID
+	}
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// a failed import must not leave the history flushed or half restored
+	return db.Transaction(func(tx *util.Database) error {
+		return importArchive(tx, uid, archive, overwrite, trusted)
+	})
+}
+
+func importArchive(db *util.Database, uid string, archive *Archive, overwrite, trusted bool) error {
+	user := repository.NewUserRepository(db)
+	role := repository.NewRoleRepository(db)
+	hist := repository.NewHistoryRepository(db)
+	credit := repository.NewCreditRepository(db)
+
+	usr, err := user.Read(uid)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// archives are uploaded by users, so their role is never trusted
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		usr = &repository.User{
+			ID:       uid,
+			Username: archive.User.Username,
+			RoleID:   ROLE_DEFAULT,
+		}
+
+		if err = user.Create(usr); err != nil {
+			return err
+		}
+	}
+
+	r, err := role.Read(usr.RoleID)
+	if err != nil {
+		return err
+	}
+
+	prompt := CleanInstructions(archive.User.Prompt)
+	if prompt != "" {
+		if prompt, err = checkInstructions(usr, r, prompt); err != nil {
+			return err
+		}
+	}
+
+	if hist.Count(uid) > 0 {
+		if !overwrite {
+			return ErrArchiveExists
+		}
+
+		if err = hist.Flush(uid); err != nil {
+			return err
+		}
+	}
+
+	// personas may not exist on this instance
+	persona := archive.User.DefaultPersona
+	if persona != "" {
+		if _, err = NewPromptService().Read(persona); err != nil {
+			persona = ""
+		}
+	}
+
+	fields := map[string]any{
+		"prompt":           prompt,
+		"default_persona":  persona,
+		"prefer_ephemeral": archive.User.PreferEphemeral,
+	}
+
+	// set rather than added, so importing the same archive twice does not
+	// count its chats twice
+	if trusted {
+		low, high := affinityRange(config.Load().Affinity)
+		fields["sentiment"] = min(max(archive.User.Sentiment, low), high)
+		fields["total"] = max(archive.User.Total, 0)
+	}
+
+	if err = user.Patch(uid, fields); err != nil {
+		return err
+	}
+
+	// the archived ledger adds up to the archived balance, so the ledger of
+	// the target still adds up to its balance after both are added
+	if trusted {
+		for _, c := range archive.Credits {
+			entry := repository.CreditEntry{
+				UserID:      uid,
+				Amount:      c.Amount,
+				Balance:     c.Balance,
+				ModeratorID: c.ModeratorID,
+				Reason:      c.Reason,
+			}
+			entry.CreatedAt = c.CreatedAt
+
+			if err = credit.Create(&entry); err != nil {
+				return err
+			}
+		}
+
+		if archive.User.Credits > 0 {
+			if _, err = user.AddCredits(uid, archive.User.Credits); err != nil {
+				return err
+			}
+		}
+	}
+
+	// parents are always created before their children, so old IDs can
+	// be remapped in a single pass
+	ids := make(map[uint]uint, len(archive.Histories))
+	for _, h := range archive.Histories {
+		entry := repository.History{
+			UserID:          uid,
+			Content:         h.Content,
+			Answer:          h.Answer,
+			Persona:         h.Persona,
+			ModelName:       h.Model,
+			NSFW:            h.NSFW,
+			PromptTokens:    h.PromptTokens,
+			CandidateTokens: h.CandidateTokens,
+			TotalTokens:     h.TotalTokens,
+			Latency:         h.Latency,
+			FinishReason:    h.FinishReason,
+			Attachments:     make([]*repository.HistoryAttachment, 0, len(h.Attachments)),
+		}
+		entry.CreatedAt = h.CreatedAt
+
+		if h.ParentID != nil {
+			if parent, ok := ids[*h.ParentID]; ok {
+				entry.ParentID = &parent
+			}
+		}
+
+		for _, attach := range h.Attachments {
+			entry.Attachments = append(entry.Attachments, &repository.HistoryAttachment{
+				URL:         attach.URL,
+				Filename:    attach.Filename,
+				ContentType: attach.ContentType,
+				Size:        attach.Size,
+				Hash:        attach.Hash,
+			})
+		}
+
+		if err = hist.Create(&entry); err != nil {
+			return err
+		}
+
+		ids[h.ID] = entry.ID
+	}
+
+	return hist.SetHead(uid, ids[archive.Head])
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+)
+
+const CHANNEL_DEFAULT_SIZE = 30
+
+type ChannelService struct{}
+
+func NewChannelService() *ChannelService {
+	return &ChannelService{}
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.ChannelMessage{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func (*ChannelService) Enabled() bool {
+	return config.Load().Channel.Enabled
+}
+
+func channelSize(cnf config.ChannelConfig) int {
+	if cnf.Size <= 0 {
+		return CHANNEL_DEFAULT_SIZE
+	}
+
+	return cnf.Size
+}
+
+// Ingest appends messages to the channel buffer and drops the ones which
+// no longer fit in it.
+func (*ChannelService) Ingest(cid string, messages ...*repository.ChannelMessage) error {
+	cnf := config.Load().Channel
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	channel := repository.NewChannelRepository(db)
+	for _, msg := range messages {
+		msg.ChannelID = cid
+		if err := channel.Create(msg); err != nil {
+			return err
+		}
+	}
+
+	return channel.Trim(cid, channelSize(cnf))
+}
+
+func (*ChannelService) Recent(cid string) ([]*repository.ChannelMessage, error) {
+	cnf := config.Load().Channel
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	since := time.Time{}
+	if cnf.MaxAge > 0 {
+		since = time.Now().Add(-time.Duration(cnf.MaxAge) * time.Minute)
+	}
+
+	channel := repository.NewChannelRepository(db)
+	return channel.Read(cid, channelSize(cnf), since)
+}
+
+func (*ChannelService) Flush(cid string) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	channel := repository.NewChannelRepository(db)
+	return channel.Flush(cid)
+}
+
+// Reencrypt rotates all buffered channel messages to the active encryption key.
+func (*ChannelService) Reencrypt() (int64, error) {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return 0, err
+	}
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	channel := repository.NewChannelRepository(db)
+	return channel.Rekey(ring)
+}
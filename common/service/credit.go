@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/util"
+)
+
+const (
+	// CREDIT_SPEND_REASON marks ledger entries of chats paid with credits.
+	CREDIT_SPEND_REASON = "chat"
+
+	// CREDIT_REFUND_REASON marks credits given back for failed chats.
+	CREDIT_REFUND_REASON = "chat refund"
+)
+
+var ErrCreditBalance = errors.New("not enough credits")
+
+type CreditService struct{}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.CreditEntry{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewCreditService() *CreditService {
+	return &CreditService{}
+}
+
+// change moves the credit balance and records it in the ledger within one
+// transaction, so the ledger always adds up to the balance.
+func (*CreditService) change(uid string, amount int, moderator, reason string) (int, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var balance int
+	err := db.Transaction(func(tx *util.Database) error {
+		user := repository.NewUserRepository(tx)
+		credit := repository.NewCreditRepository(tx)
+
+		if _, err := user.Read(uid); err != nil {
+			return err
+		}
+
+		ok, err := user.AddCredits(uid, amount)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return ErrCreditBalance
+		}
+
+		usr, err := user.Read(uid)
+		if err != nil {
+			return err
+		}
+
+		balance = usr.Credits
+		return credit.Create(&repository.CreditEntry{
+			UserID:      uid,
+			Amount:      amount,
+			Balance:     balance,
+			ModeratorID: moderator,
+			Reason:      reason,
+		})
+	})
+
+	return balance, err
+}
+
+// Grant adds credits to the user. A negative amount takes credits back.
+func (cs *CreditService) Grant(uid string, amount int, moderator, reason string) (int, error) {
+	return cs.change(uid, amount, moderator, reason)
+}
+
+// Spend pays one chat with a credit.
+func (cs *CreditService) Spend(usr *repository.User) error {
+	balance, err := cs.change(usr.ID, -1, "", CREDIT_SPEND_REASON)
+	if err != nil {
+		return err
+	}
+
+	usr.Credits = balance
+	return nil
+}
+
+// Refund gives back the credit of a chat that failed after it was spent.
+func (cs *CreditService) Refund(usr *repository.User) error {
+	balance, err := cs.change(usr.ID, 1, "", CREDIT_REFUND_REASON)
+	if err != nil {
+		return err
+	}
+
+	usr.Credits = balance
+	return nil
+}
+
+func (*CreditService) Ledger(uid string) ([]*repository.CreditEntry, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	credit := repository.NewCreditRepository(db)
+	return credit.Read(uid)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devproje/neko-engine/config"
+)
+
+const (
+	DISCORD_API_URL       = "https://discord.com/api/v10"
+	DISCORD_AUTHORIZE_URL = "https://discord.com/oauth2/authorize"
+	DISCORD_SCOPE         = "identify"
+
+	// DISCORD_UNKNOWN_MEMBER is the JSON error code of a missing member.
+	// Other 404s, such as an unknown guild, are not about the user.
+	DISCORD_UNKNOWN_MEMBER = 10007
+)
+
+var (
+	ErrDiscordRequest = errors.New("discord request failed")
+	ErrNotMember      = errors.New("user is not a member of the guild")
+)
+
+// DiscordClient talks to the Discord OAuth2 and user API. The endpoints
+// come from the config so the login can run against a mock server.
+type DiscordClient struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	APIURL       string
+	AuthorizeURL string
+	BotToken     string
+	HTTP         *http.Client
+}
+
+// DiscordError is a non-2xx response of the Discord API. It wraps
+// ErrDiscordRequest.
+type DiscordError struct {
+	Status int
+	Code   int
+	body   string
+}
+
+func (e *DiscordError) Error() string {
+	return fmt.Sprintf("%v: %d %s %s", ErrDiscordRequest, e.Status, http.StatusText(e.Status), e.body)
+}
+
+func (e *DiscordError) Unwrap() error {
+	return ErrDiscordRequest
+}
+
+type DiscordToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type DiscordMember struct {
+	User  *DiscordUser `json:"user"`
+	Roles []string     `json:"roles"`
+}
+
+type DiscordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Avatar     string `json:"avatar"`
+}
+
+func NewDiscordClient(cnf config.BotConfig) *DiscordClient {
+	client := DiscordClient{
+		ClientID:     cnf.ClientId,
+		ClientSecret: cnf.ClientSecret,
+		RedirectURI:  cnf.RedirectURI,
+		APIURL:       DISCORD_API_URL,
+		AuthorizeURL: DISCORD_AUTHORIZE_URL,
+		HTTP:         &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if cnf.APIURL != "" {
+		client.APIURL = strings.TrimSuffix(cnf.APIURL, "/")
+	}
+
+	if cnf.AuthorizeURL != "" {
+		client.AuthorizeURL = cnf.AuthorizeURL
+	}
+
+	return &client
+}
+
+// LoginURL returns the authorization page the user is redirected to.
+func (dc *DiscordClient) LoginURL(state string) string {
+	query := url.Values{
+		"client_id":     {dc.ClientID},
+		"redirect_uri":  {dc.RedirectURI},
+		"response_type": {"code"},
+		"scope":         {DISCORD_SCOPE},
+		"state":         {state},
+	}
+
+	return fmt.Sprintf("%s?%s", dc.AuthorizeURL, query.Encode())
+}
+
+// do sends the request and decodes a successful JSON response into ret.
+// Other responses fail with a *DiscordError, so callers can tell missing
+// resources apart by their status and error code.
+func (dc *DiscordClient) do(req *http.Request, ret any) error {
+	resp, err := dc.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		var data struct {
+			Code int `json:"code"`
+		}
+		_ = json.Unmarshal(body, &data)
+
+		return &DiscordError{Status: resp.StatusCode, Code: data.Code, body: string(body)}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(ret)
+}
+
+// Exchange trades an authorization code for an access token.
+func (dc *DiscordClient) Exchange(code string) (*DiscordToken, error) {
+	form := url.Values{
+		"client_id":     {dc.ClientID},
+		"client_secret": {dc.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {dc.RedirectURI},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dc.APIURL+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token DiscordToken
+	if err = dc.do(req, &token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Identify returns the Discord user the access token belongs to.
+func (dc *DiscordClient) Identify(token *DiscordToken) (*DiscordUser, error) {
+	req, err := http.NewRequest(http.MethodGet, dc.APIURL+"/users/@me", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var user DiscordUser
+	if err = dc.do(req, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Member returns the member of the guild with their role IDs. It fails
+// with ErrNotMember only if Discord reports the member as unknown.
+func (dc *DiscordClient) Member(guildID, userID string) (*DiscordMember, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/guilds/%s/members/%s", dc.APIURL, guildID, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bot "+dc.BotToken)
+
+	var member DiscordMember
+	err = dc.do(req, &member)
+
+	var derr *DiscordError
+	if errors.As(err, &derr) && derr.Status == http.StatusNotFound && derr.Code == DISCORD_UNKNOWN_MEMBER {
+		return nil, ErrNotMember
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
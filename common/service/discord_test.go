@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscordMember(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /guilds/guild/members/member", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"user":{"id":"member"},"roles":["10"]}`))
+	})
+	mux.HandleFunc("GET /guilds/guild/members/stranger", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Unknown Member","code":10007}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /guilds/unknown/members/member", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Unknown Guild","code":10004}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /guilds/guild/members/limited", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"You are being rate limited.","retry_after":1}`, http.StatusTooManyRequests)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := &DiscordClient{APIURL: server.URL, BotToken: "token", HTTP: server.Client()}
+
+	member, err := client.Member("guild", "member")
+	if err != nil {
+		t.Fatalf("Member: %v", err)
+	}
+
+	if len(member.Roles) != 1 || member.Roles[0] != "10" {
+		t.Errorf("Member returned roles %v, want [10]", member.Roles)
+	}
+
+	if _, err = client.Member("guild", "stranger"); !errors.Is(err, ErrNotMember) {
+		t.Errorf("Member of an unknown member returned %v, want ErrNotMember", err)
+	}
+
+	// only an unknown member may be cached as a negative result
+	for _, c := range [][2]string{{"unknown", "member"}, {"guild", "limited"}} {
+		_, err = client.Member(c[0], c[1])
+		if errors.Is(err, ErrNotMember) || !errors.Is(err, ErrDiscordRequest) {
+			t.Errorf("Member(%q, %q) returned %v, want ErrDiscordRequest", c[0], c[1], err)
+		}
+	}
+}
@@ -7,13 +7,23 @@ import (
 	"google.golang.org/genai"
 )
 
+// MAX_TOOL_ROUNDS bounds how many function call round trips a single
+// prompt may take before the last response is returned as is.
+const MAX_TOOL_ROUNDS = 4
+
 type GeminiService struct{}
 
+// FunctionTool is a function the model may call while answering.
+type FunctionTool struct {
+	Declaration *genai.FunctionDeclaration
+	Handler     func(args map[string]any) (map[string]any, error)
+}
+
 func NewGeminiService() *GeminiService {
 	return &GeminiService{}
 }
 
-func (*GeminiService) SendPrompt(system, model string, prompts []*genai.Content) (*genai.GenerateContentResponse, error) {
+func (*GeminiService) SendPrompt(system, model string, prompts []*genai.Content, tools ...*FunctionTool) (*genai.GenerateContentResponse, error) {
 	cnf := config.Load()
 	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
 		APIKey:  cnf.Gemini.Token,
@@ -23,37 +33,120 @@ func (*GeminiService) SendPrompt(system, model string, prompts []*genai.Content)
 		return nil, err
 	}
 
+	// built-in search tools can not be combined with function calling,
+	// so they are only enabled while no function tools are given
+	builtin := []*genai.Tool{
+		{
+			GoogleSearch: &genai.GoogleSearch{},
+			URLContext:   &genai.URLContext{},
+		},
+	}
+
+	handlers := make(map[string]*FunctionTool, len(tools))
+	if len(tools) > 0 {
+		declarations := make([]*genai.FunctionDeclaration, 0, len(tools))
+		for _, tool := range tools {
+			declarations = append(declarations, tool.Declaration)
+			handlers[tool.Declaration.Name] = tool
+		}
+
+		builtin = []*genai.Tool{{FunctionDeclarations: declarations}}
+	}
+
 	system += "\noutput text length must be fewer 2000\n"
+	contents := append([]*genai.Content{}, prompts...)
+	usage := &genai.GenerateContentResponseUsageMetadata{}
+
+	var result *genai.GenerateContentResponse
+	for round := 0; round <= MAX_TOOL_ROUNDS; round++ {
+		result, err = client.Models.GenerateContent(
+			context.Background(),
+			model,
+			contents,
+			&genai.GenerateContentConfig{
+				SystemInstruction: &genai.Content{
+					Role: genai.RoleUser,
+					Parts: []*genai.Part{
+						{Text: system},
+					},
+				},
+				Tools: builtin,
+				Temperature: func() *float32 {
+					var ret float32 = 0.5
+					return &ret
+				}(),
+				MaxOutputTokens: 15000,
+				ThinkingConfig: &genai.ThinkingConfig{
+					IncludeThoughts: true,
+				},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.UsageMetadata != nil {
+			usage.PromptTokenCount += result.UsageMetadata.PromptTokenCount
+			usage.CandidatesTokenCount += result.UsageMetadata.CandidatesTokenCount
+			usage.ThoughtsTokenCount += result.UsageMetadata.ThoughtsTokenCount
+			usage.CachedContentTokenCount += result.UsageMetadata.CachedContentTokenCount
+			usage.TotalTokenCount += result.UsageMetadata.TotalTokenCount
+		}
+
+		calls := result.FunctionCalls()
+		if len(calls) == 0 || len(result.Candidates) == 0 || round == MAX_TOOL_ROUNDS {
+			break
+		}
+
+		contents = append(contents, result.Candidates[0].Content)
+		for _, call := range calls {
+			response := map[string]any{"error": "unknown function"}
+			if tool, ok := handlers[call.Name]; ok {
+				ret, err := tool.Handler(call.Args)
+				if err != nil {
+					ret = map[string]any{"error": err.Error()}
+				}
+
+				response = ret
+			}
+
+			contents = append(contents, genai.NewContentFromFunctionResponse(call.Name, response, genai.RoleUser))
+		}
+	}
+
+	// report the usage of every round, not only the last one
+	result.UsageMetadata = usage
+	return result, nil
+}
+
+// Generate sends a single plain text prompt without tools or thinking,
+// for cheap internal tasks such as scoring.
+func (*GeminiService) Generate(system, model, text string) (string, *genai.GenerateContentResponseUsageMetadata, error) {
+	cnf := config.Load()
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:  cnf.Gemini.Token,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
 	result, err := client.Models.GenerateContent(
 		context.Background(),
 		model,
-		prompts,
+		genai.Text(text),
 		&genai.GenerateContentConfig{
-			SystemInstruction: &genai.Content{
-				Role: genai.RoleUser,
-				Parts: []*genai.Part{
-					{Text: system},
-				},
-			},
-			Tools: []*genai.Tool{
-				{
-					GoogleSearch: &genai.GoogleSearch{},
-					URLContext:   &genai.URLContext{},
-				},
-			},
+			SystemInstruction: genai.NewContentFromText(system, genai.RoleUser),
 			Temperature: func() *float32 {
-				var ret float32 = 0.5
+				var ret float32 = 0
 				return &ret
 			}(),
-			MaxOutputTokens: 15000,
-			ThinkingConfig: &genai.ThinkingConfig{
-				IncludeThoughts: true,
-			},
+			MaxOutputTokens: 16,
 		},
 	)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	return result, nil
+	return result.Text(), result.UsageMetadata, nil
 }
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+)
+
+var ErrGuildExists = errors.New("guild already exists")
+
+type GuildService struct{}
+
+// GuildPatch holds the guild fields to change. Nil fields are left untouched.
+type GuildPatch struct {
+	Name   *string
+	RoleID *int
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.Guild{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewGuildService() *GuildService {
+	return &GuildService{}
+}
+
+func (p *GuildPatch) apply(guild *repository.Guild) {
+	if p.Name != nil {
+		guild.Name = *p.Name
+	}
+
+	if p.RoleID != nil {
+		guild.RoleID = *p.RoleID
+	}
+}
+
+// ReadGuild returns the guild together with the role of its quota pool.
+func (*GuildService) ReadGuild(id string) (*repository.Guild, *repository.Role, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	guild := repository.NewGuildRepository(db)
+	role := repository.NewRoleRepository(db)
+
+	data, err := guild.Read(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := role.Read(data.RoleID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, r, nil
+}
+
+func (*GuildService) CreateGuild(id string, patch *GuildPatch) (*repository.Guild, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	guild := repository.NewGuildRepository(db)
+	role := repository.NewRoleRepository(db)
+	if _, err := guild.Read(id); err == nil {
+		return nil, ErrGuildExists
+	}
+
+	// the pool role is configured by name, as role IDs differ per instance
+	data := repository.Guild{ID: id, RoleID: ROLE_SERVER}
+	if name := config.Load().Guild.Role; name != "" && patch.RoleID == nil {
+		r, err := role.ReadByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		data.RoleID = r.Id
+	}
+
+	patch.apply(&data)
+	if _, err := role.Read(data.RoleID); err != nil {
+		return nil, err
+	}
+
+	if err := guild.Create(&data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (*GuildService) UpdateGuild(id string, patch *GuildPatch) (*repository.Guild, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	guild := repository.NewGuildRepository(db)
+	role := repository.NewRoleRepository(db)
+	data, err := guild.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	patch.apply(data)
+	if _, err = role.Read(data.RoleID); err != nil {
+		return nil, err
+	}
+
+	if err = guild.Update(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (*GuildService) DeleteGuild(id string) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	guild := repository.NewGuildRepository(db)
+	if _, err := guild.Read(id); err != nil {
+		return err
+	}
+
+	return guild.Delete(id)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/util"
+)
+
+var (
+	ErrInstructionsDisabled = errors.New("custom instructions are disabled for this role")
+	ErrInstructionsTooLong  = errors.New("custom instructions are too long")
+	ErrInstructionsRejected = errors.New("custom instructions look like a prompt injection")
+)
+
+// instructionTags matches the blocks of the system prompt, so custom
+// instructions can not close their own block or fake another one.
+var instructionTags = regexp.MustCompile(`(?i)<\s*/?\s*(CUSTOM_INSTRUCTIONS|USER_PROFILE|CURRENT_CONTEXT|CHANNEL_CONTEXT|AFFINITY|HISTORY_METADATA|SYSTEM[A-Z_]*)\s*>`)
+
+var instructionInjections = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|system|persona)\s+(instructions?|prompts?|rules|messages?)`),
+	regexp.MustCompile(`(?i)(reveal|print|show|repeat|output)\s+(me\s+)?(your|the)\s+(system\s+prompt|instructions|persona\s+prompt)`),
+	regexp.MustCompile(`(?i)you\s+are\s+no\s+longer`),
+	regexp.MustCompile(`(?i)\b(developer|dan|god)\s+mode\b`),
+	regexp.MustCompile(`(?i)\bjailbreak`),
+}
+
+type InstructionService struct{}
+
+func NewInstructionService() *InstructionService {
+	return &InstructionService{}
+}
+
+// CleanInstructions removes control characters and prompt block tags from
+// custom instructions.
+func CleanInstructions(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+
+		return -1
+	}, text)
+
+	return strings.TrimSpace(instructionTags.ReplaceAllString(text, ""))
+}
+
+// RoleInstructions returns the custom instructions of the user as allowed
+// by their current role. Instructions saved under a role with a higher
+// limit are cut to the limit of the current one.
+func RoleInstructions(usr *repository.User, r *repository.Role) string {
+	text := CleanInstructions(usr.Prompt)
+	if usr.RoleID == ROLE_ROOT {
+		return text
+	}
+
+	if r.PromptLimit <= 0 {
+		return ""
+	}
+
+	if runes := []rune(text); len(runes) > r.PromptLimit {
+		text = strings.TrimSpace(string(runes[:r.PromptLimit]))
+	}
+
+	return text
+}
+
+// checkInstructions cleans text and checks it against the injection filter
+// and the prompt limit of the user's role.
+func checkInstructions(usr *repository.User, r *repository.Role, text string) (string, error) {
+	text = CleanInstructions(text)
+	for _, pattern := range instructionInjections {
+		if pattern.MatchString(text) {
+			return "", ErrInstructionsRejected
+		}
+	}
+
+	if usr.RoleID != ROLE_ROOT {
+		if r.PromptLimit <= 0 {
+			return "", ErrInstructionsDisabled
+		}
+
+		if utf8.RuneCountInString(text) > r.PromptLimit {
+			return "", ErrInstructionsTooLong
+		}
+	}
+
+	return text, nil
+}
+
+func (*InstructionService) Read(id string) (string, int, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return "", 0, err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	role := repository.NewRoleRepository(db)
+	usr, err := user.Read(id)
+	if err != nil {
+		return "", 0, err
+	}
+
+	r, err := role.Read(usr.RoleID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return usr.Prompt, r.PromptLimit, nil
+}
+
+func (*InstructionService) Set(id, text string) (string, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	role := repository.NewRoleRepository(db)
+	usr, err := user.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := role.Read(usr.RoleID)
+	if err != nil {
+		return "", err
+	}
+
+	if text, err = checkInstructions(usr, r, text); err != nil {
+		return "", err
+	}
+
+	if err = user.Patch(usr.ID, map[string]any{"prompt": text}); err != nil {
+		return "", err
+	}
+
+	return text, nil
+}
+
+func (*InstructionService) Clear(id string) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user := repository.NewUserRepository(db)
+	if _, err := user.Read(id); err != nil {
+		return err
+	}
+
+	return user.Patch(id, map[string]any{"prompt": ""})
+}
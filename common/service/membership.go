@@ -0,0 +1,321 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+const (
+	MEMBERSHIP_REPORT = "report"
+	MEMBERSHIP_LOOKUP = "lookup"
+
+	// MEMBERSHIP_MODERATOR is the moderator of role changes made for
+	// official server perks.
+	MEMBERSHIP_MODERATOR = "membership"
+
+	MEMBERSHIP_TTL_DEFAULT = 60
+
+	// MEMBERSHIP_RETRY is how long a failed lookup is not retried, so an
+	// unavailable or rate limiting Discord is not asked on every chat.
+	MEMBERSHIP_RETRY = time.Minute
+)
+
+// MemberLookup looks members of a Discord guild up. DiscordClient
+// implements it, other implementations can be injected for testing.
+type MemberLookup interface {
+	Member(guildID, userID string) (*DiscordMember, error)
+}
+
+type MembershipService struct {
+	Account *AccountService
+	Lookup  MemberLookup
+}
+
+// Perks is what a user gets for their official server membership.
+type Perks struct {
+	Member bool     `json:"member"`
+	Roles  []string `json:"roles"`
+	Role   string   `json:"role"`
+	Bonus  int      `json:"bonus"`
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.Membership{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+// NewMembershipService creates the service. lookup may be nil if members
+// are only reported by the bot.
+func NewMembershipService(account *AccountService, lookup MemberLookup) *MembershipService {
+	return &MembershipService{Account: account, Lookup: lookup}
+}
+
+func (*MembershipService) Enabled() bool {
+	cnf := config.Load()
+	return cnf.Membership.Enabled && cnf.Bot.OfficialServerId != ""
+}
+
+func membershipTTL(cnf config.MembershipConfig) time.Duration {
+	ttl := cnf.CacheTTL
+	if ttl <= 0 {
+		ttl = MEMBERSHIP_TTL_DEFAULT
+	}
+
+	return time.Duration(ttl) * time.Minute
+}
+
+// rules returns the perk rules that apply to the membership.
+func rules(cnf config.MembershipConfig, membership *repository.Membership) []config.MembershipRule {
+	list := make([]config.MembershipRule, 0)
+	if !membership.Member {
+		return list
+	}
+
+	list = append(list, cnf.Member)
+	for _, id := range membership.RoleIDs() {
+		if rule, ok := cnf.Roles[id]; ok {
+			list = append(list, rule)
+		}
+	}
+
+	return list
+}
+
+// Report stores the membership as told by the bot and applies its perks.
+func (ms *MembershipService) Report(uid string, member bool, roles []string) (*repository.Membership, error) {
+	return ms.save(uid, member, roles, MEMBERSHIP_REPORT)
+}
+
+func (ms *MembershipService) save(uid string, member bool, roles []string, source string) (*repository.Membership, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	repo := repository.NewMembershipRepository(db)
+	data, err := repo.Read(uid)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !member {
+		roles = nil
+	}
+
+	data.UserID = uid
+	data.Member = member
+	data.Roles = strings.Join(roles, ",")
+	data.Source = source
+	data.CheckedAt = time.Now()
+	data.RetryAt = nil
+
+	// the granted role must never be recorded apart from the role itself,
+	// or it could not be taken back later
+	err = db.Transaction(func(tx *util.Database) error {
+		if err := ms.syncRole(tx, data); err != nil {
+			return err
+		}
+
+		return repository.NewMembershipRepository(tx).Save(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Status returns the cached membership of the user. Looked up memberships
+// are checked again through the Discord API once the cache has expired,
+// reported ones stay valid until the bot reports a change. Unregistered
+// users are never looked up. Only an unknown member is cached as a
+// negative result, failed lookups are retried after MEMBERSHIP_RETRY.
+func (ms *MembershipService) Status(uid string) (*repository.Membership, error) {
+	cnf := config.Load()
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	repo := repository.NewMembershipRepository(db)
+	data, err := repo.Read(uid)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	found := err == nil
+	fresh := found && (data.Source == MEMBERSHIP_REPORT || time.Since(data.CheckedAt) < membershipTTL(cnf.Membership))
+	backoff := found && data.RetryAt != nil && time.Now().Before(*data.RetryAt)
+	if fresh || backoff || ms.Lookup == nil || cnf.Membership.BotToken == "" {
+		data.UserID = uid
+		return data, nil
+	}
+
+	if _, err = repository.NewUserRepository(db).Read(uid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			data.UserID = uid
+			return data, nil
+		}
+
+		return nil, err
+	}
+
+	member, err := ms.Lookup.Member(cnf.Bot.OfficialServerId, uid)
+	if errors.Is(err, ErrNotMember) {
+		return ms.save(uid, false, nil, MEMBERSHIP_LOOKUP)
+	}
+
+	if err != nil {
+		// keep serving the stale status while Discord is unavailable, a user
+		// without one is stored as no member until the lookup succeeds
+		retry := time.Now().Add(MEMBERSHIP_RETRY)
+		data.UserID = uid
+		data.RetryAt = &retry
+		if !found {
+			data.Source = MEMBERSHIP_LOOKUP
+		}
+
+		if serr := repo.Save(data); serr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", serr)
+		}
+
+		if found {
+			return data, nil
+		}
+
+		return nil, err
+	}
+
+	return ms.save(uid, true, member.Roles, MEMBERSHIP_LOOKUP)
+}
+
+// syncRole grants the best engine role the membership maps to. Only users
+// on the default role are promoted, so moderator assignments are kept, and
+// the role is taken back once the membership no longer grants it.
+func (ms *MembershipService) syncRole(db *util.Database, membership *repository.Membership) error {
+	role := repository.NewRoleRepository(db)
+	user := repository.NewUserRepository(db)
+
+	var target *repository.Role
+	for _, rule := range rules(config.Load().Membership, membership) {
+		if rule.Role == "" {
+			continue
+		}
+
+		r, err := role.ReadByName(rule.Role)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "membership role \"%s\" is not found\n", rule.Role)
+			continue
+		}
+
+		if target == nil || r.Limit > target.Limit {
+			target = r
+		}
+	}
+
+	usr, err := user.Read(membership.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	granted := membership.GrantedRoleID != 0 && usr.RoleID == membership.GrantedRoleID
+	switch {
+	case target != nil && target.Id != usr.RoleID && (usr.RoleID == ROLE_DEFAULT || granted):
+		if _, err = assignRole(db, usr.ID, target.Id, MEMBERSHIP_MODERATOR, "official server membership", nil); err != nil {
+			return err
+		}
+
+		membership.GrantedRoleID = target.Id
+	case target == nil && granted:
+		if _, err = assignRole(db, usr.ID, ROLE_DEFAULT, MEMBERSHIP_MODERATOR, "official server membership ended", nil); err != nil {
+			return err
+		}
+
+		membership.GrantedRoleID = 0
+	case target == nil:
+		membership.GrantedRoleID = 0
+	}
+
+	return nil
+}
+
+// Perks returns the membership perks of the user. Errors are logged and
+// treated as no membership, so Discord outages never block chatting.
+func (ms *MembershipService) Perks(uid string) *Perks {
+	perks := Perks{Roles: []string{}}
+	if !ms.Enabled() {
+		return &perks
+	}
+
+	membership, err := ms.Status(uid)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return &perks
+	}
+
+	perks.Member = membership.Member
+	perks.Roles = membership.RoleIDs()
+	for _, rule := range rules(config.Load().Membership, membership) {
+		perks.Bonus += rule.Bonus
+	}
+
+	if membership.GrantedRoleID != 0 {
+		if role, err := ms.Account.GetRoleById(membership.GrantedRoleID); err == nil {
+			perks.Role = role.Name
+		}
+	}
+
+	return &perks
+}
+
+// Apply returns the membership perks of the registered user usr. The
+// membership may grant or take back a role, so usr is read again after
+// the perks are resolved.
+func (ms *MembershipService) Apply(usr *repository.User) *Perks {
+	perks := ms.Perks(usr.ID)
+	if !ms.Enabled() {
+		return perks
+	}
+
+	if fresh, err := ms.Account.ReadUser(usr.ID); err == nil {
+		*usr = *fresh
+	}
+
+	return perks
+}
+
+// Boost returns a copy of the role with the daily bonus chats of the perks
+// added to its limit. Roles without a chat limit are returned as they are.
+func (*MembershipService) Boost(role *repository.Role, perks *Perks) *repository.Role {
+	if perks.Bonus == 0 || !messageCapped(role) {
+		return role
+	}
+
+	boosted := *role
+	boosted.Limit += perks.Bonus
+	return &boosted
+}
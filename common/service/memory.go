@@ -1,11 +1,14 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/devproje/neko-engine/common/repository"
 	"github.com/devproje/neko-engine/util"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
 )
 
 type MemoryService struct{}
@@ -28,10 +31,31 @@ func init() {
 	}
 	defer db.Close()
 
-	if err := db.GetDB().AutoMigrate(&repository.History{}); err != nil {
+	if err := db.GetDB().AutoMigrate(&repository.History{}, &repository.HistoryAttachment{}, &repository.HistoryHead{}); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 		return
 	}
+
+	if !db.GetDB().Migrator().HasIndex(&repository.History{}, "idx_history_fulltext") {
+		err := db.GetDB().Exec("CREATE FULLTEXT INDEX idx_history_fulltext ON histories (content, answer)").Error
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "full-text index is not available, history search falls back to LIKE: %v\n", err)
+		}
+	}
+
+	// link histories written before conversation branching existed
+	hist := repository.NewHistoryRepository(db)
+	users, err := hist.Unlinked()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+
+	for _, uid := range users {
+		if err = hist.Chain(uid); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
 }
 
 func (*MemoryService) LoadHistory(uid string) (*MemoryData, error) {
@@ -42,7 +66,7 @@ func (*MemoryService) LoadHistory(uid string) (*MemoryData, error) {
 	defer db.Close()
 
 	hist := repository.NewHistoryRepository(db)
-	history, err := hist.Read(uid, 20) // load last chats
+	history, err := hist.ReadBranch(uid, 20) // load last chats of the active branch
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +79,33 @@ func (*MemoryService) LoadHistory(uid string) (*MemoryData, error) {
 	return &md, nil
 }
 
+func (*MemoryService) LastHistory(uid string) (*repository.History, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	return hist.ReadHead(uid)
+}
+
+func (*MemoryService) ListHistory(uid string, page, size int) ([]*repository.History, int, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	list, err := hist.ReadPage(uid, (page-1)*size, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return list, hist.Count(uid), nil
+}
+
 func (*MemoryService) AppendHistory(history *repository.History) error {
 	db := util.NewDatabase()
 	if err := db.Open(); err != nil {
@@ -63,11 +114,70 @@ func (*MemoryService) AppendHistory(history *repository.History) error {
 	defer db.Close()
 
 	hist := repository.NewHistoryRepository(db)
+	head, err := hist.ReadHead(history.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if head != nil {
+		history.ParentID = &head.ID
+	}
+
+	if err = hist.Create(history); err != nil {
+		return err
+	}
+
+	return hist.SetHead(history.UserID, history.ID)
+}
+
+// BranchHistory stores history as a sibling of base and makes it the
+// active branch, keeping base as an alternative.
+func (*MemoryService) BranchHistory(base, history *repository.History) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	history.ParentID = base.ParentID
 	if err := hist.Create(history); err != nil {
 		return err
 	}
 
-	return nil
+	return hist.SetHead(history.UserID, history.ID)
+}
+
+func (*MemoryService) ListBranches(uid string, id uint) ([]*repository.History, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	return hist.ReadSiblings(uid, id)
+}
+
+// Checkout switches the active branch to the latest leaf below id.
+func (*MemoryService) Checkout(uid string, id uint) (*repository.History, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	leaf, err := hist.ReadLeaf(uid, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = hist.SetHead(uid, leaf.ID); err != nil {
+		return nil, err
+	}
+
+	return leaf, nil
 }
 
 func (*MemoryService) PurgeLast(uid string) error {
@@ -100,6 +210,21 @@ func (*MemoryService) PurgeN(uid string, n int) error {
 	return nil
 }
 
+func (*MemoryService) DeleteHistory(uid string, id uint) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	if err := hist.Delete(uid, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (*MemoryService) FlushHistory(uid string) error {
 	db := util.NewDatabase()
 	if err := db.Open(); err != nil {
@@ -114,3 +239,69 @@ func (*MemoryService) FlushHistory(uid string) error {
 
 	return nil
 }
+
+func (*MemoryService) SearchHistory(uid, query string, limit int) ([]*repository.History, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	return hist.Search(uid, query, limit)
+}
+
+// SearchTool lets the persona look up past conversations of the user.
+func (ms *MemoryService) SearchTool(uid string) *FunctionTool {
+	return &FunctionTool{
+		Declaration: &genai.FunctionDeclaration{
+			Name:        "search_history",
+			Description: "Search earlier messages and answers of the current user. Use it when the user refers to something discussed before that is not in the recent history.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"query": {
+						Type:        genai.TypeString,
+						Description: "keywords to search for",
+					},
+				},
+				Required: []string{"query"},
+			},
+		},
+		Handler: func(args map[string]any) (map[string]any, error) {
+			query, _ := args["query"].(string)
+			list, err := ms.SearchHistory(uid, query, 5)
+			if err != nil {
+				return nil, err
+			}
+
+			results := make([]map[string]any, 0, len(list))
+			for _, hist := range list {
+				results = append(results, map[string]any{
+					"timestamp": hist.CreatedAt.Unix(),
+					"user":      hist.Content,
+					"bot":       hist.Answer,
+				})
+			}
+
+			return map[string]any{"results": results}, nil
+		},
+	}
+}
+
+// Reencrypt rotates all stored chat history to the active encryption key.
+func (*MemoryService) Reencrypt() (int64, error) {
+	ring, err := util.GetKeyring()
+	if err != nil {
+		return 0, err
+	}
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	hist := repository.NewHistoryRepository(db)
+	return hist.Rekey(ring)
+}
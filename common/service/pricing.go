@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+	"google.golang.org/genai"
+)
+
+const (
+	CAP_REFUSE    = "refuse"
+	CAP_DOWNGRADE = "downgrade"
+)
+
+var ErrSpendCap = errors.New("spend cap reached")
+
+type PricingService struct{}
+
+func NewPricingService() *PricingService {
+	return &PricingService{}
+}
+
+// Cost estimates the price of a provider call in dollars. Cached prompt
+// tokens are billed at the cached rate instead of the input rate.
+func (*PricingService) Cost(model string, usage *genai.GenerateContentResponseUsageMetadata) float64 {
+	price, ok := config.Load().Pricing.Models[model]
+	if !ok || usage == nil {
+		return 0
+	}
+
+	cached := float64(usage.CachedContentTokenCount)
+	input := float64(usage.PromptTokenCount) - cached
+
+	cost := input*price.Input +
+		cached*price.Cached +
+		float64(usage.CandidatesTokenCount)*price.Output +
+		float64(usage.ThoughtsTokenCount)*price.Thinking
+
+	return cost / 1_000_000
+}
+
+// Spend returns the estimated spend of the current day and month in the
+// quota reset timezone.
+func (*PricingService) Spend() (float64, float64, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	now := time.Now().In(resetLocation(config.Load().Reset))
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	ledger := repository.NewUsageRepository(db)
+	daily, err := ledger.SumCost(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	monthly, err := ledger.SumCost(month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return daily, monthly, nil
+}
+
+// Model returns the model to answer with. Once a spend cap is reached the
+// fallback model is returned, or ErrSpendCap if chats are refused.
+func (ps *PricingService) Model(model string) (string, error) {
+	cnf := config.Load().Pricing
+	if cnf.DailyCap <= 0 && cnf.MonthlyCap <= 0 {
+		return model, nil
+	}
+
+	daily, monthly, err := ps.Spend()
+	if err != nil {
+		return "", err
+	}
+
+	reached := (cnf.DailyCap > 0 && daily >= cnf.DailyCap) || (cnf.MonthlyCap > 0 && monthly >= cnf.MonthlyCap)
+	if !reached {
+		return model, nil
+	}
+
+	if cnf.CapAction == CAP_DOWNGRADE && cnf.FallbackModel != "" {
+		return cnf.FallbackModel, nil
+	}
+
+	return "", ErrSpendCap
+}
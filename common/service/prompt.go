@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/devproje/neko-engine/config"
 	"github.com/pelletier/go-toml/v2"
@@ -12,17 +13,45 @@ import (
 type PromptService struct{}
 
 type NKFile struct {
-	Model  string `toml:"model"`
+	Model  string   `toml:"model"`
+	Tools  []string `toml:"tools"`
 	Prompt struct {
 		Default string `toml:"default"`
 		NSFW    string `toml:"nsfw"`
 	} `toml:"prompt"`
+	Affinity []*AffinityTier `toml:"affinity"`
+}
+
+// AffinityTier is a prompt fragment used once the user's affinity score
+// reaches Min.
+type AffinityTier struct {
+	Name   string `toml:"name"`
+	Min    int    `toml:"min"`
+	Prompt string `toml:"prompt"`
 }
 
 func NewPromptService() *PromptService {
 	return &PromptService{}
 }
 
+// HasTool reports whether the persona enabled the named function tool.
+func (nk *NKFile) HasTool(name string) bool {
+	return slices.Contains(nk.Tools, name)
+}
+
+// Tier returns the affinity tier with the highest Min the score reaches,
+// or nil if the persona defines no matching tier.
+func (nk *NKFile) Tier(score int) *AffinityTier {
+	var tier *AffinityTier
+	for _, t := range nk.Affinity {
+		if score >= t.Min && (tier == nil || t.Min > tier.Min) {
+			tier = t
+		}
+	}
+
+	return tier
+}
+
 func (*PromptService) Read(persona string) (*NKFile, error) {
 	filename := fmt.Sprintf("%s.nkfile", persona)
 	raw, err := os.ReadFile(filepath.Join(config.ConfigPath, "prompt", filename))
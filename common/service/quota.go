@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/util"
+	"google.golang.org/genai"
+)
+
+// TOKENS_PER_MEDIA is a rough token cost of a single attachment, used for
+// pre-flight estimates only.
+const TOKENS_PER_MEDIA = 258
+
+var (
+	ErrChatLimit  = errors.New("chat limit reached")
+	ErrTokenLimit = errors.New("token budget exhausted")
+)
+
+type QuotaService struct{}
+
+// Quota is the remaining daily usage of a user, -1 meaning unlimited.
+type Quota struct {
+	Messages int `json:"messages"`
+	Tokens   int `json:"tokens"`
+}
+
+func NewQuotaService() *QuotaService {
+	return &QuotaService{}
+}
+
+// messageCapped reports whether the role limits the number of chats. Roles
+// with a token budget may leave Limit at zero to only use the budget.
+func messageCapped(role *repository.Role) bool {
+	return role.Limit > 0 || role.TokenLimit <= 0
+}
+
+func remaining(roleID, count, tokens int, role *repository.Role) *Quota {
+	quota := Quota{Messages: -1, Tokens: -1}
+	if roleID == ROLE_ROOT {
+		return &quota
+	}
+
+	if messageCapped(role) {
+		quota.Messages = max(role.Limit-count, 0)
+	}
+
+	if role.TokenLimit > 0 {
+		quota.Tokens = max(role.TokenLimit-tokens, 0)
+	}
+
+	return &quota
+}
+
+func allow(roleID, count, tokens int, role *repository.Role, estimate int) error {
+	if roleID == ROLE_ROOT {
+		return nil
+	}
+
+	if messageCapped(role) && count+1 > role.Limit {
+		return ErrChatLimit
+	}
+
+	if role.TokenLimit > 0 && tokens+max(estimate, 1) > role.TokenLimit {
+		return ErrTokenLimit
+	}
+
+	return nil
+}
+
+func (*QuotaService) Remaining(usr *repository.User, role *repository.Role) *Quota {
+	return remaining(usr.RoleID, usr.Count, usr.TokenCount, role)
+}
+
+// Allow checks whether the user may send one more chat. estimate is the
+// expected token cost of the request, or zero if it is not known yet.
+func (*QuotaService) Allow(usr *repository.User, role *repository.Role, estimate int) error {
+	return allow(usr.RoleID, usr.Count, usr.TokenCount, role, estimate)
+}
+
+func (*QuotaService) GuildRemaining(guild *repository.Guild, role *repository.Role) *Quota {
+	return remaining(guild.RoleID, guild.Count, guild.TokenCount, role)
+}
+
+// AllowGuild checks whether the quota pool of the guild covers one more chat.
+func (*QuotaService) AllowGuild(guild *repository.Guild, role *repository.Role, estimate int) error {
+	return allow(guild.RoleID, guild.Count, guild.TokenCount, role, estimate)
+}
+
+// Charge adds one chat and the actually used tokens to the daily usage.
+func (*QuotaService) Charge(usr *repository.User, tokens int) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	user := repository.NewUserRepository(db)
+	if err := user.AddUsage(usr.ID, 1, tokens, now); err != nil {
+		return err
+	}
+
+	if usr.QuotaStartedAt == nil {
+		usr.QuotaStartedAt = &now
+	}
+
+	usr.Count++
+	usr.TokenCount += tokens
+	return nil
+}
+
+// ChargeGuild adds one chat and the used tokens to the quota pool of the guild.
+func (*QuotaService) ChargeGuild(guild *repository.Guild, tokens int) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	repo := repository.NewGuildRepository(db)
+	if err := repo.AddUsage(guild.ID, 1, tokens, now); err != nil {
+		return err
+	}
+
+	if guild.QuotaStartedAt == nil {
+		guild.QuotaStartedAt = &now
+	}
+
+	guild.Count++
+	guild.TokenCount += tokens
+	return nil
+}
+
+// EstimateTokens roughly estimates the prompt tokens of a request without
+// calling the provider.
+func EstimateTokens(system string, input []*genai.Content) int {
+	runes := utf8.RuneCountInString(system)
+	media := 0
+	for _, content := range input {
+		for _, part := range content.Parts {
+			if part.Text != "" {
+				runes += utf8.RuneCountInString(part.Text)
+				continue
+			}
+
+			media++
+		}
+	}
+
+	return runes/4 + media*TOKENS_PER_MEDIA
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devproje/neko-engine/common/repository"
+)
+
+func TestQuotaTokenOnlyRole(t *testing.T) {
+	role := &repository.Role{Limit: 0, TokenLimit: 1000}
+
+	if err := allow(ROLE_DEFAULT, 500, 0, role, 10); err != nil {
+		t.Errorf("allow of a token only role returned %v", err)
+	}
+
+	if err := allow(ROLE_DEFAULT, 0, 995, role, 10); !errors.Is(err, ErrTokenLimit) {
+		t.Errorf("allow over the token budget returned %v, want ErrTokenLimit", err)
+	}
+
+	quota := remaining(ROLE_DEFAULT, 500, 400, role)
+	if quota.Messages != -1 || quota.Tokens != 600 {
+		t.Errorf("remaining of a token only role returned %+v, want {-1 600}", *quota)
+	}
+}
+
+func TestQuotaMessageLimit(t *testing.T) {
+	cases := []*repository.Role{
+		{Limit: 5},
+		{Limit: 5, TokenLimit: 1000},
+	}
+
+	for _, role := range cases {
+		if err := allow(ROLE_DEFAULT, 5, 0, role, 0); !errors.Is(err, ErrChatLimit) {
+			t.Errorf("allow of %+v at its limit returned %v, want ErrChatLimit", role, err)
+		}
+
+		if quota := remaining(ROLE_DEFAULT, 3, 0, role); quota.Messages != 2 {
+			t.Errorf("remaining of %+v returned %d messages, want 2", role, quota.Messages)
+		}
+	}
+
+	// a role without any limit can not chat at all
+	if err := allow(ROLE_DEFAULT, 0, 0, &repository.Role{}, 0); !errors.Is(err, ErrChatLimit) {
+		t.Errorf("allow of a role without limits returned %v, want ErrChatLimit", err)
+	}
+}
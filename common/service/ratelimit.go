@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+)
+
+const (
+	RATE_STORE_MEMORY   = "memory"
+	RATE_STORE_DATABASE = "database"
+)
+
+var ErrRateLimited = errors.New("too many requests")
+
+// RateWindow allows at most Limit requests within any Size long window.
+type RateWindow struct {
+	Size  time.Duration
+	Limit int
+}
+
+// RateStore keeps the recent requests of every user. Take records a
+// request if it fits into all windows, otherwise it returns how long the
+// user has to wait until it would.
+type RateStore interface {
+	Take(uid string, now time.Time, windows []RateWindow) (time.Duration, error)
+}
+
+type RateLimitService struct {
+	store RateStore
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.RateHit{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewRateLimitService() *RateLimitService {
+	var store RateStore = newMemoryRateStore()
+	if config.Load().RateLimit.Store == RATE_STORE_DATABASE {
+		store = &databaseRateStore{}
+	}
+
+	return &RateLimitService{store: store}
+}
+
+func roleWindows(role *repository.Role) []RateWindow {
+	windows := make([]RateWindow, 0, 2)
+	if role.MinuteLimit > 0 {
+		windows = append(windows, RateWindow{Size: time.Minute, Limit: role.MinuteLimit})
+	}
+
+	if role.HourLimit > 0 {
+		windows = append(windows, RateWindow{Size: time.Hour, Limit: role.HourLimit})
+	}
+
+	return windows
+}
+
+func widest(windows []RateWindow) time.Duration {
+	var size time.Duration
+	for _, window := range windows {
+		size = max(size, window.Size)
+	}
+
+	return size
+}
+
+// retryAfter returns how long to wait until one more request fits into
+// all windows. hits must be sorted from oldest to newest.
+func retryAfter(hits []time.Time, now time.Time, windows []RateWindow) time.Duration {
+	var wait time.Duration
+	for _, window := range windows {
+		since := now.Add(-window.Size)
+		count := 0
+		for _, hit := range hits {
+			if hit.After(since) {
+				count++
+			}
+		}
+
+		if count < window.Limit {
+			continue
+		}
+
+		// the request that has to expire before another one fits
+		freed := hits[len(hits)-window.Limit]
+		wait = max(wait, freed.Add(window.Size).Sub(now))
+	}
+
+	return wait
+}
+
+// Take records a provider request of the user, or returns ErrRateLimited
+// together with the time until the next request is allowed.
+func (rs *RateLimitService) Take(usr *repository.User, role *repository.Role) (time.Duration, error) {
+	windows := roleWindows(role)
+	if usr.RoleID == ROLE_ROOT || len(windows) == 0 {
+		return 0, nil
+	}
+
+	wait, err := rs.store.Take(usr.ID, time.Now(), windows)
+	if err != nil {
+		return 0, err
+	}
+
+	if wait > 0 {
+		return wait, ErrRateLimited
+	}
+
+	return 0, nil
+}
+
+type memoryRateStore struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{hits: make(map[string][]time.Time)}
+}
+
+func (s *memoryRateStore) Take(uid string, now time.Time, windows []RateWindow) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := now.Add(-widest(windows))
+	hits := s.hits[uid]
+	for len(hits) > 0 && !hits[0].After(since) {
+		hits = hits[1:]
+	}
+
+	if wait := retryAfter(hits, now, windows); wait > 0 {
+		s.hits[uid] = hits
+		return wait, nil
+	}
+
+	s.hits[uid] = append(hits, now)
+	return 0, nil
+}
+
+type databaseRateStore struct{}
+
+func (*databaseRateStore) Take(uid string, now time.Time, windows []RateWindow) (time.Duration, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var wait time.Duration
+	err := db.Transaction(func(tx *util.Database) error {
+		rate := repository.NewRateHitRepository(tx)
+		if err := rate.Lock(uid); err != nil {
+			return err
+		}
+
+		since := now.Add(-widest(windows))
+		if err := rate.Prune(uid, since); err != nil {
+			return err
+		}
+
+		list, err := rate.ReadSince(uid, since)
+		if err != nil {
+			return err
+		}
+
+		hits := make([]time.Time, 0, len(list))
+		for _, hit := range list {
+			hits = append(hits, hit.CreatedAt)
+		}
+
+		if wait = retryAfter(hits, now, windows); wait > 0 {
+			return nil
+		}
+
+		return rate.Create(&repository.RateHit{UserID: uid, CreatedAt: now})
+	})
+
+	return wait, err
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+const (
+	RESET_DAILY   = "daily"
+	RESET_WEEKLY  = "weekly"
+	RESET_ROLLING = "rolling"
+
+	// RESET_JOB is the schedule row of the quota reset.
+	RESET_JOB = "quota-reset"
+
+	// RESET_CHECK_INTERVAL is how often the scheduler checks for a due
+	// reset. Polling keeps it correct across host sleep and clock changes.
+	RESET_CHECK_INTERVAL = time.Minute
+
+	// RESET_LEASE bounds how long a crashed instance can block the reset.
+	RESET_LEASE = 5 * time.Minute
+)
+
+type ResetService struct {
+	holder string
+}
+
+type ResetReport struct {
+	Reset  bool
+	Rolled int64
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.Schedule{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewResetService() *ResetService {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+
+	return &ResetService{holder: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf))}
+}
+
+func resetLocation(cnf config.ResetConfig) *time.Location {
+	if cnf.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(cnf.Timezone)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid reset timezone \"%s\": %v\n", cnf.Timezone, err)
+		return time.Local
+	}
+
+	return loc
+}
+
+func resetWeekday(cnf config.ResetConfig) time.Weekday {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), cnf.Weekday) {
+			return day
+		}
+	}
+
+	return time.Monday
+}
+
+// previousReset returns the latest scheduled reset at or before now.
+func previousReset(cnf config.ResetConfig, now time.Time) time.Time {
+	local := now.In(resetLocation(cnf))
+	boundary := time.Date(local.Year(), local.Month(), local.Day(), cnf.Hour, 0, 0, 0, local.Location())
+	if boundary.After(local) {
+		boundary = boundary.AddDate(0, 0, -1)
+	}
+
+	if cnf.Schedule == RESET_WEEKLY {
+		day := resetWeekday(cnf)
+		for boundary.Weekday() != day {
+			boundary = boundary.AddDate(0, 0, -1)
+		}
+	}
+
+	return boundary
+}
+
+// NextReset returns when the usage of the user is reset next.
+func (*ResetService) NextReset(usr *repository.User) *time.Time {
+	cnf := config.Load().Reset
+	if cnf.Schedule == RESET_ROLLING {
+		if usr.QuotaStartedAt == nil {
+			return nil
+		}
+
+		next := usr.QuotaStartedAt.Add(24 * time.Hour)
+		return &next
+	}
+
+	next := previousReset(cnf, time.Now())
+	if cnf.Schedule == RESET_WEEKLY {
+		next = next.AddDate(0, 0, 7)
+	} else {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return &next
+}
+
+// Run resets the usage counters if a reset is due, catching up on resets
+// missed while no instance was running. Only the instance holding the
+// lease performs the reset.
+func (rs *ResetService) Run() (*ResetReport, error) {
+	cnf := config.Load().Reset
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	schedule := repository.NewScheduleRepository(db)
+	user := repository.NewUserRepository(db)
+	guild := repository.NewGuildRepository(db)
+
+	now := time.Now()
+	ok, err := schedule.Acquire(RESET_JOB, rs.holder, now, now.Add(RESET_LEASE))
+	if err != nil || !ok {
+		return nil, err
+	}
+	defer func() {
+		_ = schedule.Release(RESET_JOB, rs.holder, time.Now())
+	}()
+
+	var report ResetReport
+	if cnf.Schedule == RESET_ROLLING {
+		if report.Rolled, err = user.ResetStarted(now.Add(-24 * time.Hour)); err != nil {
+			return nil, err
+		}
+
+		_, err = guild.ResetStarted(now.Add(-24 * time.Hour))
+		return &report, err
+	}
+
+	job, err := schedule.Read(RESET_JOB)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	due := previousReset(cnf, now)
+	if job.LastRun == nil {
+		// the last reset of older versions is unknown, so start counting
+		// from the latest scheduled one instead of resetting right away
+		return &report, schedule.SetLastRun(RESET_JOB, due)
+	}
+
+	if !job.LastRun.Before(due) {
+		return &report, nil
+	}
+
+	if err = user.ResetAll(); err != nil {
+		return nil, err
+	}
+
+	if err = guild.ResetAll(); err != nil {
+		return nil, err
+	}
+
+	report.Reset = true
+	return &report, schedule.SetLastRun(RESET_JOB, now)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+)
+
+type RetentionService struct{}
+
+type RetentionReport struct {
+	Expired int64
+	Trimmed int64
+	Purged  int64
+}
+
+func NewRetentionService() *RetentionService {
+	return &RetentionService{}
+}
+
+// Interval returns how long the janitor waits between sweeps.
+func (*RetentionService) Interval() time.Duration {
+	interval := config.Load().Retention.Interval
+	if interval <= 0 {
+		interval = 60
+	}
+
+	return time.Duration(interval) * time.Minute
+}
+
+// Sweep enforces the retention policy of every role once.
+func (*RetentionService) Sweep() (*RetentionReport, error) {
+	cnf := config.Load().Retention
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	role := repository.NewRoleRepository(db)
+	hist := repository.NewHistoryRepository(db)
+
+	roles, err := role.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var report RetentionReport
+	now := time.Now()
+	for _, r := range roles {
+		policy := cnf.Policy(r.Name)
+		if policy.MaxAge > 0 {
+			n, err := hist.ExpireBefore(r.Id, now.AddDate(0, 0, -policy.MaxAge))
+			if err != nil {
+				return &report, err
+			}
+
+			report.Expired += n
+		}
+
+		if policy.MaxRows <= 0 {
+			continue
+		}
+
+		users, err := hist.Overflowing(r.Id, policy.MaxRows)
+		if err != nil {
+			return &report, err
+		}
+
+		for _, uid := range users {
+			n, err := hist.Trim(uid, policy.MaxRows)
+			if err != nil {
+				return &report, err
+			}
+
+			report.Trimmed += n
+		}
+	}
+
+	if cnf.PurgeDeleted > 0 {
+		n, err := hist.PurgeDeleted(now.AddDate(0, 0, -cnf.PurgeDeleted))
+		if err != nil {
+			return &report, err
+		}
+
+		report.Purged = n
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/util"
+)
+
+const (
+	ROLE_ROOT    = 1
+	ROLE_DEFAULT = 2
+	ROLE_SERVER  = 3
+
+	// ROLE_PROMPT_LIMIT_DEFAULT is the custom instruction length of roles
+	// created without one.
+	ROLE_PROMPT_LIMIT_DEFAULT = 1000
+)
+
+var (
+	ErrRoleExists    = errors.New("role name already exists")
+	ErrRoleProtected = errors.New("built-in role can not be deleted")
+	ErrRoleInUse     = errors.New("role is still assigned to users")
+)
+
+type RoleService struct{}
+
+// RolePatch holds the role fields to change. Nil fields are left untouched.
+type RolePatch struct {
+	Name          *string
+	Limit         *int
+	TokenLimit    *int
+	MinuteLimit   *int
+	HourLimit     *int
+	PromptLimit   *int
+	EphemeralFree *bool
+}
+
+func NewRoleService() *RoleService {
+	return &RoleService{}
+}
+
+func (p *RolePatch) apply(role *repository.Role) {
+	if p.Name != nil {
+		role.Name = *p.Name
+	}
+
+	if p.Limit != nil {
+		role.Limit = *p.Limit
+	}
+
+	if p.TokenLimit != nil {
+		role.TokenLimit = *p.TokenLimit
+	}
+
+	if p.MinuteLimit != nil {
+		role.MinuteLimit = *p.MinuteLimit
+	}
+
+	if p.HourLimit != nil {
+		role.HourLimit = *p.HourLimit
+	}
+
+	if p.PromptLimit != nil {
+		role.PromptLimit = *p.PromptLimit
+	}
+
+	if p.EphemeralFree != nil {
+		role.EphemeralFree = *p.EphemeralFree
+	}
+}
+
+func (*RoleService) ListRoles() ([]*repository.Role, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	role := repository.NewRoleRepository(db)
+	return role.List()
+}
+
+func (*RoleService) CreateRole(patch *RolePatch) (*repository.Role, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	role := repository.NewRoleRepository(db)
+	if _, err := role.ReadByName(*patch.Name); err == nil {
+		return nil, ErrRoleExists
+	}
+
+	data := repository.Role{PromptLimit: ROLE_PROMPT_LIMIT_DEFAULT}
+	patch.apply(&data)
+	if err := role.Create(&data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (*RoleService) UpdateRole(id int, patch *RolePatch) (*repository.Role, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	role := repository.NewRoleRepository(db)
+	data, err := role.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil && *patch.Name != data.Name {
+		if _, err = role.ReadByName(*patch.Name); err == nil {
+			return nil, ErrRoleExists
+		}
+	}
+
+	patch.apply(data)
+	if err = role.Update(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// DeleteRole removes a role. Users still assigned to it are moved to the
+// reassign role, or the deletion is refused if reassign is zero.
+func (*RoleService) DeleteRole(id, reassign int) error {
+	if id == ROLE_ROOT || id == ROLE_DEFAULT {
+		return ErrRoleProtected
+	}
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// users must never be left pointing at a deleted role
+	return db.Transaction(func(tx *util.Database) error {
+		role := repository.NewRoleRepository(tx)
+		user := repository.NewUserRepository(tx)
+		guild := repository.NewGuildRepository(tx)
+		if _, err := role.Read(id); err != nil {
+			return err
+		}
+
+		if user.CountByRole(id) > 0 || guild.CountByRole(id) > 0 {
+			if reassign == 0 || reassign == id {
+				return ErrRoleInUse
+			}
+
+			if _, err := role.Read(reassign); err != nil {
+				return err
+			}
+
+			if err := user.Reassign(id, reassign); err != nil {
+				return err
+			}
+
+			if err := guild.Reassign(id, reassign); err != nil {
+				return err
+			}
+		}
+
+		return role.Delete(id)
+	})
+}
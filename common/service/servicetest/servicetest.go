@@ -0,0 +1,168 @@
+// Package servicetest provides fakes of the service dependencies and a
+// mock of the Discord API for tests of the service and controller packages.
+package servicetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"gorm.io/gorm"
+)
+
+const (
+	CLIENT_ID     = "client"
+	CLIENT_SECRET = "secret"
+	REDIRECT_URI  = "http://localhost/auth/callback"
+	CODE          = "good-code"
+	ACCESS_TOKEN  = "access-token"
+	USER_ID       = "1001"
+)
+
+// NewDiscord starts a local server that speaks the parts of the Discord
+// OAuth2 and user API used by the login. It accepts only CODE and
+// ACCESS_TOKEN and identifies them as USER_ID.
+func NewDiscord(t *testing.T) *service.DiscordClient {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+
+		if r.PostForm.Get("client_id") != CLIENT_ID ||
+			r.PostForm.Get("client_secret") != CLIENT_SECRET ||
+			r.PostForm.Get("grant_type") != "authorization_code" ||
+			r.PostForm.Get("redirect_uri") != REDIRECT_URI ||
+			r.PostForm.Get("code") != CODE {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(service.DiscordToken{
+			AccessToken: ACCESS_TOKEN,
+			TokenType:   "Bearer",
+			ExpiresIn:   604800,
+			Scope:       service.DISCORD_SCOPE,
+		})
+	})
+	mux.HandleFunc("GET /users/@me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+ACCESS_TOKEN {
+			http.Error(w, `{"message":"401: Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(service.DiscordUser{
+			ID:         USER_ID,
+			Username:   "neko",
+			GlobalName: "Neko",
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &service.DiscordClient{
+		ClientID:     CLIENT_ID,
+		ClientSecret: CLIENT_SECRET,
+		RedirectURI:  REDIRECT_URI,
+		APIURL:       server.URL,
+		AuthorizeURL: server.URL + "/oauth2/authorize",
+		HTTP:         server.Client(),
+	}
+}
+
+// Accounts keeps users in memory. It implements service.SessionAccounts.
+type Accounts struct {
+	Users   map[string]*repository.User
+	Created []string
+}
+
+func NewAccounts(users ...*repository.User) *Accounts {
+	accounts := Accounts{Users: make(map[string]*repository.User)}
+	for _, usr := range users {
+		accounts.Users[usr.ID] = usr
+	}
+
+	return &accounts
+}
+
+func (a *Accounts) ReadUser(id string) (*repository.User, error) {
+	usr, ok := a.Users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *usr
+	return &copied, nil
+}
+
+func (a *Accounts) CreateUser(id, author string) error {
+	a.Users[id] = &repository.User{ID: id, Username: author, RoleID: service.ROLE_DEFAULT}
+	a.Created = append(a.Created, id)
+	return nil
+}
+
+func (a *Accounts) PatchUser(id string, fields map[string]any) error {
+	usr, ok := a.Users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if name, ok := fields["username"].(string); ok {
+		usr.Username = name
+	}
+
+	return nil
+}
+
+// SessionStore keeps sessions in memory. It implements service.SessionStore
+// the way the database store does.
+type SessionStore struct {
+	Sessions []*repository.Session
+}
+
+func (s *SessionStore) Create(session *repository.Session) error {
+	session.ID = uint(len(s.Sessions) + 1)
+	session.CreatedAt = time.Now()
+	s.Sessions = append(s.Sessions, session)
+	return nil
+}
+
+func (s *SessionStore) ReadByHash(hash string) (*repository.Session, error) {
+	for _, session := range s.Sessions {
+		if session.TokenHash == hash {
+			return session, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *SessionStore) List(uid string, now time.Time) ([]*repository.Session, error) {
+	list := make([]*repository.Session, 0)
+	for _, session := range s.Sessions {
+		if session.UserID == uid && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			list = append(list, session)
+		}
+	}
+
+	return list, nil
+}
+
+func (s *SessionStore) Revoke(uid string, id uint, now time.Time) (bool, error) {
+	for _, session := range s.Sessions {
+		if session.ID == id && session.UserID == uid && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/config"
+	"github.com/devproje/neko-engine/util"
+	"gorm.io/gorm"
+)
+
+const SESSION_AGE_DEFAULT = 30
+
+var ErrSessionInvalid = errors.New("session is invalid or expired")
+
+// SessionAccounts maps Discord users to engine accounts. AccountService
+// implements it.
+type SessionAccounts interface {
+	ReadUser(id string) (*repository.User, error)
+	CreateUser(id, author string) error
+	PatchUser(id string, fields map[string]any) error
+}
+
+// SessionStore keeps the issued sessions. The database store is used by
+// the server, other implementations can be injected for testing.
+type SessionStore interface {
+	Create(session *repository.Session) error
+	ReadByHash(hash string) (*repository.Session, error)
+	List(uid string, now time.Time) ([]*repository.Session, error)
+	Revoke(uid string, id uint, now time.Time) (bool, error)
+}
+
+type SessionService struct {
+	Account SessionAccounts
+	Discord *DiscordClient
+	Store   SessionStore
+}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.Session{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewSessionService(account SessionAccounts, discord *DiscordClient) *SessionService {
+	return &SessionService{Account: account, Discord: discord, Store: &databaseSessionStore{}}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns a URL safe random string of n bytes of entropy.
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func sessionAge() time.Duration {
+	days := config.Load().Server.SessionAge
+	if days <= 0 {
+		days = SESSION_AGE_DEFAULT
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Login finishes the Discord authorization code flow. The Discord user is
+// mapped to the account with the same ID, which is created on first login,
+// and a new session is issued for it.
+func (ss *SessionService) Login(code, agent string) (string, *repository.Session, *repository.User, error) {
+	token, err := ss.Discord.Exchange(code)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	identity, err := ss.Discord.Identify(token)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	name := identity.GlobalName
+	if name == "" {
+		name = identity.Username
+	}
+
+	usr, err := ss.Account.ReadUser(identity.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err = ss.Account.CreateUser(identity.ID, name); err != nil {
+			return "", nil, nil, err
+		}
+
+		usr, err = ss.Account.ReadUser(identity.ID)
+	}
+
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if usr.Username != name {
+		usr.Username = name
+		if err = ss.Account.PatchUser(usr.ID, map[string]any{"username": name}); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	raw, session, err := ss.Issue(usr.ID, agent)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return raw, session, usr, nil
+}
+
+// Issue creates a session for the user and returns its opaque token.
+func (ss *SessionService) Issue(uid, agent string) (string, *repository.Session, error) {
+	raw, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data := repository.Session{
+		TokenHash: hashToken(raw),
+		UserID:    uid,
+		UserAgent: agent,
+		ExpiresAt: time.Now().Add(sessionAge()),
+	}
+
+	if err = ss.Store.Create(&data); err != nil {
+		return "", nil, err
+	}
+
+	return raw, &data, nil
+}
+
+// Verify returns the session of the token if it has not expired.
+func (ss *SessionService) Verify(raw string) (*repository.Session, error) {
+	data, err := ss.Store.ReadByHash(hashToken(raw))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data.RevokedAt != nil || !data.ExpiresAt.After(time.Now()) {
+		return nil, ErrSessionInvalid
+	}
+
+	return data, nil
+}
+
+func (ss *SessionService) ListSessions(uid string) ([]*repository.Session, error) {
+	return ss.Store.List(uid, time.Now())
+}
+
+// Revoke ends a session of the user. It fails with ErrSessionInvalid if
+// the session does not belong to the user or has already been revoked.
+func (ss *SessionService) Revoke(uid string, id uint) error {
+	ok, err := ss.Store.Revoke(uid, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrSessionInvalid
+	}
+
+	return nil
+}
+
+// databaseSessionStore keeps sessions in the database.
+type databaseSessionStore struct{}
+
+func (*databaseSessionStore) Create(data *repository.Session) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	session := repository.NewSessionRepository(db)
+	return session.Create(data)
+}
+
+func (*databaseSessionStore) ReadByHash(hash string) (*repository.Session, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	session := repository.NewSessionRepository(db)
+	return session.ReadByHash(hash)
+}
+
+func (*databaseSessionStore) List(uid string, now time.Time) ([]*repository.Session, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	session := repository.NewSessionRepository(db)
+	return session.List(uid, now)
+}
+
+func (*databaseSessionStore) Revoke(uid string, id uint, now time.Time) (bool, error) {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	session := repository.NewSessionRepository(db)
+	return session.Revoke(uid, id, now)
+}
@@ -0,0 +1,176 @@
+package service_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/devproje/neko-engine/common/service/servicetest"
+)
+
+func TestDiscordLoginURL(t *testing.T) {
+	client := servicetest.NewDiscord(t)
+
+	raw := client.LoginURL("state-123")
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("LoginURL returned an invalid URL %q: %v", raw, err)
+	}
+
+	if base := parsed.Scheme + "://" + parsed.Host + parsed.Path; base != client.AuthorizeURL {
+		t.Errorf("LoginURL points to %q, want %q", base, client.AuthorizeURL)
+	}
+
+	want := map[string]string{
+		"client_id":     servicetest.CLIENT_ID,
+		"redirect_uri":  servicetest.REDIRECT_URI,
+		"response_type": "code",
+		"scope":         service.DISCORD_SCOPE,
+		"state":         "state-123",
+	}
+
+	for key, value := range want {
+		if got := parsed.Query().Get(key); got != value {
+			t.Errorf("LoginURL query %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestDiscordExchange(t *testing.T) {
+	client := servicetest.NewDiscord(t)
+
+	token, err := client.Exchange(servicetest.CODE)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if token.AccessToken != servicetest.ACCESS_TOKEN {
+		t.Errorf("Exchange returned access token %q, want %q", token.AccessToken, servicetest.ACCESS_TOKEN)
+	}
+
+	if _, err = client.Exchange("bad-code"); !errors.Is(err, service.ErrDiscordRequest) {
+		t.Errorf("Exchange with a bad code returned %v, want ErrDiscordRequest", err)
+	}
+}
+
+func TestDiscordIdentify(t *testing.T) {
+	client := servicetest.NewDiscord(t)
+
+	usr, err := client.Identify(&service.DiscordToken{AccessToken: servicetest.ACCESS_TOKEN})
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+
+	if usr.ID != servicetest.USER_ID || usr.GlobalName != "Neko" {
+		t.Errorf("Identify returned %+v", usr)
+	}
+
+	if _, err = client.Identify(&service.DiscordToken{AccessToken: "expired"}); !errors.Is(err, service.ErrDiscordRequest) {
+		t.Errorf("Identify with a bad token returned %v, want ErrDiscordRequest", err)
+	}
+}
+
+func TestSessionLoginExistingUser(t *testing.T) {
+	accounts := servicetest.NewAccounts(&repository.User{ID: servicetest.USER_ID, Username: "old name", RoleID: service.ROLE_DEFAULT})
+	ss := &service.SessionService{Account: accounts, Discord: servicetest.NewDiscord(t), Store: &servicetest.SessionStore{}}
+
+	token, session, usr, err := ss.Login(servicetest.CODE, "test-agent")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	if len(accounts.Created) != 0 {
+		t.Errorf("Login created accounts %v for an existing user", accounts.Created)
+	}
+
+	if usr.ID != servicetest.USER_ID || session.UserID != servicetest.USER_ID {
+		t.Errorf("Login mapped to user %q with session of %q, want %q", usr.ID, session.UserID, servicetest.USER_ID)
+	}
+
+	if accounts.Users[servicetest.USER_ID].Username != "Neko" {
+		t.Errorf("Login kept the username %q, want the Discord global name", accounts.Users[servicetest.USER_ID].Username)
+	}
+
+	if session.UserAgent != "test-agent" || session.TokenHash == token {
+		t.Errorf("Login stored session %+v", session)
+	}
+
+	found, err := ss.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify of the issued token: %v", err)
+	}
+
+	if found.ID != session.ID {
+		t.Errorf("Verify returned session %d, want %d", found.ID, session.ID)
+	}
+}
+
+func TestSessionLoginCreatesUser(t *testing.T) {
+	accounts := servicetest.NewAccounts()
+	ss := &service.SessionService{Account: accounts, Discord: servicetest.NewDiscord(t), Store: &servicetest.SessionStore{}}
+
+	_, _, usr, err := ss.Login(servicetest.CODE, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	if len(accounts.Created) != 1 || accounts.Created[0] != servicetest.USER_ID {
+		t.Errorf("Login created accounts %v, want [%s]", accounts.Created, servicetest.USER_ID)
+	}
+
+	if usr.Username != "Neko" {
+		t.Errorf("Login created user named %q, want %q", usr.Username, "Neko")
+	}
+}
+
+func TestSessionLoginBadCode(t *testing.T) {
+	store := &servicetest.SessionStore{}
+	ss := &service.SessionService{Account: servicetest.NewAccounts(), Discord: servicetest.NewDiscord(t), Store: store}
+
+	if _, _, _, err := ss.Login("bad-code", ""); !errors.Is(err, service.ErrDiscordRequest) {
+		t.Errorf("Login with a bad code returned %v, want ErrDiscordRequest", err)
+	}
+
+	if len(store.Sessions) != 0 {
+		t.Errorf("Login with a bad code issued %d sessions", len(store.Sessions))
+	}
+}
+
+func TestSessionVerify(t *testing.T) {
+	store := &servicetest.SessionStore{}
+	ss := &service.SessionService{Account: servicetest.NewAccounts(), Store: store}
+
+	token, session, err := ss.Issue(servicetest.USER_ID, "")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if _, err = ss.Verify("unknown"); !errors.Is(err, service.ErrSessionInvalid) {
+		t.Errorf("Verify of an unknown token returned %v, want ErrSessionInvalid", err)
+	}
+
+	if err = ss.Revoke("someone else", session.ID); !errors.Is(err, service.ErrSessionInvalid) {
+		t.Errorf("Revoke of another user's session returned %v, want ErrSessionInvalid", err)
+	}
+
+	if err = ss.Revoke(servicetest.USER_ID, session.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	if _, err = ss.Verify(token); !errors.Is(err, service.ErrSessionInvalid) {
+		t.Errorf("Verify of a revoked token returned %v, want ErrSessionInvalid", err)
+	}
+
+	expired, session, err := ss.Issue(servicetest.USER_ID, "")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+
+	if _, err = ss.Verify(expired); !errors.Is(err, service.ErrSessionInvalid) {
+		t.Errorf("Verify of an expired token returned %v, want ErrSessionInvalid", err)
+	}
+}
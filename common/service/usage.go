@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/util"
+)
+
+var ErrUsageGroup = errors.New("unknown usage group")
+
+// usageGroups maps the report groups to the ledger column they are
+// aggregated by.
+var usageGroups = map[string]string{
+	"user":    "user_id",
+	"role":    "role_id",
+	"persona": "persona",
+	"model":   "model",
+	"guild":   "guild_id",
+	"purpose": "purpose",
+	"day":     "DATE_FORMAT(created_at, '%Y-%m-%d')",
+}
+
+type UsageService struct{}
+
+func init() {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.GetDB().AutoMigrate(&repository.Usage{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+}
+
+func NewUsageService() *UsageService {
+	return &UsageService{}
+}
+
+// Record writes a provider call to the ledger and counts successful chats
+// into the lifetime total of the user.
+func (*UsageService) Record(usage *repository.Usage) error {
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if usage.Purpose == "" {
+		usage.Purpose = repository.USAGE_CHAT
+	}
+
+	ledger := repository.NewUsageRepository(db)
+	user := repository.NewUserRepository(db)
+	if err := ledger.Create(usage); err != nil {
+		return err
+	}
+
+	if usage.Status != repository.USAGE_OK || usage.Purpose != repository.USAGE_CHAT {
+		return nil
+	}
+
+	return user.IncreaseTotal(usage.UserID)
+}
+
+func (*UsageService) Report(group string, filter *repository.UsageFilter) ([]*repository.UsageSummary, error) {
+	column, ok := usageGroups[group]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUsageGroup, group)
+	}
+
+	db := util.NewDatabase()
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ledger := repository.NewUsageRepository(db)
+	return ledger.Aggregate(column, filter)
+}
@@ -9,10 +9,20 @@ import (
 )
 
 type Config struct {
-	Bot      BotConfig      `toml:"bot"`
-	Server   ServerConfig   `toml:"server"`
-	Database DatabaseConfig `toml:"database"`
-	Gemini   GeminiConfig   `toml:"gemini"`
+	Bot        BotConfig        `toml:"bot"`
+	Server     ServerConfig     `toml:"server"`
+	Database   DatabaseConfig   `toml:"database"`
+	Gemini     GeminiConfig     `toml:"gemini"`
+	Chat       ChatConfig       `toml:"chat"`
+	Retention  RetentionConfig  `toml:"retention"`
+	Encryption EncryptionConfig `toml:"encryption"`
+	Channel    ChannelConfig    `toml:"channel"`
+	Guild      GuildConfig      `toml:"guild"`
+	RateLimit  RateLimitConfig  `toml:"rate-limit"`
+	Reset      ResetConfig      `toml:"reset"`
+	Pricing    PricingConfig    `toml:"pricing"`
+	Affinity   AffinityConfig   `toml:"affinity"`
+	Membership MembershipConfig `toml:"membership"`
 }
 
 type BotConfig struct {
@@ -20,12 +30,15 @@ type BotConfig struct {
 	ClientSecret     string `toml:"client-secret"`
 	RedirectURI      string `toml:"redirect-uri"`
 	OfficialServerId string `toml:"official-server-id"`
+	APIURL           string `toml:"api-url"`
+	AuthorizeURL     string `toml:"authorize-url"`
 }
 
 type ServerConfig struct {
-	Host   string `toml:"host"`
-	Port   int    `toml:"port"`
-	Secret string `toml:"secret"`
+	Host       string `toml:"host"`
+	Port       int    `toml:"port"`
+	Secret     string `toml:"secret"`
+	SessionAge int    `toml:"session-age"`
 }
 
 type DatabaseConfig struct {
@@ -40,6 +53,106 @@ type GeminiConfig struct {
 	Token string `toml:"token"`
 }
 
+type ChatConfig struct {
+	CountRegenerate *bool `toml:"count-regenerate"`
+}
+
+// CountsRegenerate reports whether regenerations count against the daily
+// chat limit. They do unless the config turns it off explicitly.
+func (c ChatConfig) CountsRegenerate() bool {
+	return c.CountRegenerate == nil || *c.CountRegenerate
+}
+
+type RetentionConfig struct {
+	Interval     int                        `toml:"interval"`
+	MaxAge       int                        `toml:"max-age"`
+	MaxRows      int                        `toml:"max-rows"`
+	PurgeDeleted int                        `toml:"purge-deleted"`
+	Role         map[string]RetentionPolicy `toml:"role"`
+}
+
+type RetentionPolicy struct {
+	MaxAge  int `toml:"max-age"`
+	MaxRows int `toml:"max-rows"`
+}
+
+// Policy returns the retention policy of the role, falling back to the
+// global policy if the role has no override.
+func (rc *RetentionConfig) Policy(role string) RetentionPolicy {
+	if policy, ok := rc.Role[role]; ok {
+		return policy
+	}
+
+	return RetentionPolicy{MaxAge: rc.MaxAge, MaxRows: rc.MaxRows}
+}
+
+type EncryptionConfig struct {
+	Enabled   bool              `toml:"enabled"`
+	ActiveKey string            `toml:"active-key"`
+	KeyFile   string            `toml:"key-file"`
+	Keys      map[string]string `toml:"keys"`
+}
+
+type ChannelConfig struct {
+	Enabled bool `toml:"enabled"`
+	Size    int  `toml:"size"`
+	MaxAge  int  `toml:"max-age"`
+}
+
+type GuildConfig struct {
+	Role string `toml:"role"`
+}
+
+type RateLimitConfig struct {
+	Store string `toml:"store"`
+}
+
+type ResetConfig struct {
+	Timezone string `toml:"timezone"`
+	Schedule string `toml:"schedule"`
+	Hour     int    `toml:"hour"`
+	Weekday  string `toml:"weekday"`
+}
+
+type PricingConfig struct {
+	DailyCap      float64               `toml:"daily-cap"`
+	MonthlyCap    float64               `toml:"monthly-cap"`
+	CapAction     string                `toml:"cap-action"`
+	FallbackModel string                `toml:"fallback-model"`
+	Models        map[string]ModelPrice `toml:"models"`
+}
+
+// ModelPrice is the price of one million tokens of each kind.
+type ModelPrice struct {
+	Input    float64 `toml:"input"`
+	Output   float64 `toml:"output"`
+	Thinking float64 `toml:"thinking"`
+	Cached   float64 `toml:"cached"`
+}
+
+type AffinityConfig struct {
+	Enabled  bool   `toml:"enabled"`
+	Scorer   string `toml:"scorer"`
+	Model    string `toml:"model"`
+	MaxDelta int    `toml:"max-delta"`
+	Min      int    `toml:"min"`
+	Max      int    `toml:"max"`
+}
+
+type MembershipConfig struct {
+	Enabled  bool                      `toml:"enabled"`
+	BotToken string                    `toml:"bot-token"`
+	CacheTTL int                       `toml:"cache-ttl"`
+	Member   MembershipRule            `toml:"member"`
+	Roles    map[string]MembershipRule `toml:"roles"`
+}
+
+// MembershipRule is the perk of an official server member or role.
+type MembershipRule struct {
+	Role  string `toml:"role"`
+	Bonus int    `toml:"bonus"`
+}
+
 type PromptConfig struct {
 	Model   string `toml:"model"`
 	Default string `toml:"default"`
@@ -53,6 +166,10 @@ client-secret = "<discord client secret>"
 redirect-uri = "<discord callback url>"
 official-server-id = "<official discord server id>"
 
+# Discord endpoints of the OAuth2 login. Only change them to point at a mock server.
+api-url = "https://discord.com/api/v10"
+authorize-url = "https://discord.com/oauth2/authorize"
+
 [server]
 host = "0.0.0.0"
 port = 3000
@@ -60,6 +177,9 @@ port = 3000
 # please generate secret key and paste for gen-secret.sh script.
 secret = ""
 
+# login sessions expire after N days
+session-age = 30
+
 [database]
 host = "127.0.0.1"
 port = 3306
@@ -69,6 +189,132 @@ password = "<mariadb_password>"
 
 [gemini]
 token = ""
+
+[chat]
+# If true (the default), regenerating the last answer counts against the daily chat limit.
+count-regenerate = true
+
+[retention]
+# janitor run interval in minutes
+interval = 60
+
+# delete chat history older than N days (0 = keep forever)
+max-age = 0
+
+# keep only the newest N chat history rows per user (0 = unlimited)
+max-rows = 0
+
+# permanently remove deleted chat history after N days (0 = never)
+purge-deleted = 30
+
+# per-role overrides, keyed by role name
+# [retention.role.user]
+# max-age = 90
+# max-rows = 2000
+
+[encryption]
+# encrypt chat history content at rest with AES-GCM
+enabled = false
+
+# key id used to encrypt new data. keep old keys listed until
+# "neko-engine history reencrypt" has rotated every row.
+active-key = ""
+
+# optional env file with "<key id>=<hex key>" lines, merged with [encryption.keys]
+key-file = ""
+
+# please generate keys for gen-secret.sh script.
+[encryption.keys]
+# k1 = "<64 hex chars>"
+
+[channel]
+# share recent messages of all channel participants with the persona
+enabled = false
+
+# number of recent messages kept per channel
+size = 30
+
+# ignore channel messages older than N minutes
+max-age = 60
+
+[guild]
+# engine role of the quota pool of newly registered guilds
+role = "server"
+
+[rate-limit]
+# where request windows of the per-minute and per-hour role limits are kept.
+# "memory" is per process, "database" is shared between multiple instances.
+store = "memory"
+
+[reset]
+# timezone of the daily chat limit reset, e.g. "Asia/Seoul" (empty = server local time)
+timezone = ""
+
+# "daily", "weekly" or "rolling" (24 hours after each user's first counted chat)
+schedule = "daily"
+
+# hour of the day the daily and weekly reset runs at
+hour = 0
+
+# day of the weekly reset
+weekday = "monday"
+
+[pricing]
+# stop spending once the estimated cost of the day or month reaches N dollars (0 = no cap)
+daily-cap = 0.0
+monthly-cap = 0.0
+
+# "refuse" rejects chats once a cap is reached, "downgrade" answers with fallback-model instead
+cap-action = "refuse"
+fallback-model = "gemini-2.5-flash"
+
+# dollars per 1M tokens, models without a price are tracked at no cost
+[pricing.models."gemini-2.5-pro"]
+input = 1.25
+output = 10.0
+thinking = 10.0
+cached = 0.31
+
+[pricing.models."gemini-2.5-flash"]
+input = 0.3
+output = 2.5
+thinking = 2.5
+cached = 0.075
+
+[affinity]
+# score every exchange and move the user's affinity towards the persona
+enabled = false
+
+# "heuristic" scores by keywords, "model" asks a cheap model and falls back to the heuristic
+scorer = "heuristic"
+model = "gemini-2.5-flash-lite"
+
+# largest change of a single exchange, and the bounds of the affinity score
+max-delta = 3
+min = -100
+max = 100
+
+[membership]
+# grant perks to members of the official server (bot.official-server-id)
+enabled = false
+
+# bot token used to look members up through the Discord API.
+# leave it empty if the bot reports memberships to the engine instead.
+bot-token = ""
+
+# minutes a looked up membership is trusted before it is checked again
+cache-ttl = 60
+
+# perks of every member of the official server.
+# "role" switches default users to the named engine role, "bonus" adds daily chats.
+[membership.member]
+role = ""
+bonus = 0
+
+# perks of members holding a Discord role, keyed by the Discord role id
+# [membership.roles."<discord role id>"]
+# role = "server"
+# bonus = 20
 `
 	MODEL_DEFAULT_BUF = `model = "gemini-2.5-pro"
 default = "<general_prompt>"
@@ -133,7 +379,7 @@ func Load() *Config {
 		_, _ = fmt.Fprintf(os.Stderr, "config.toml is not found!\n")
 		_ = os.WriteFile(filepath.Join(ConfigPath, "config.toml"), []byte(CONFIG_DEFAULT_BUF), 0644)
 
-		return nil
+		buf = []byte(CONFIG_DEFAULT_BUF)
 	}
 
 	var config Config
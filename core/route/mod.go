@@ -2,8 +2,39 @@ package route
 
 import (
 	"github.com/devproje/neko-engine/common"
+	"github.com/devproje/neko-engine/middleware"
 	"github.com/gin-gonic/gin"
 )
 
 func CoreRouter(app *gin.Engine, sl *common.ServiceLoader) {
+	app.GET("/auth/login", sl.Auth.Login)
+	app.GET("/auth/callback", sl.Auth.Callback)
+
+	auth := app.Group("", middleware.CheckSession(sl.Session))
+	auth.GET("/auth/session", sl.Auth.FetchSession)
+	auth.POST("/auth/logout", sl.Auth.Logout)
+
+	// self service endpoints of the logged-in user, banned users are rejected
+	me := app.Group("/v1/me",
+		middleware.CheckSession(sl.Session),
+		middleware.SessionUser,
+		middleware.CheckBan(sl.Account),
+	)
+	me.GET("", sl.Acc.FetchAccount)
+	me.GET("/usage", sl.Usage.FetchAccountUsage)
+	me.GET("/credits", sl.Acc.FetchCredits)
+	me.GET("/membership", sl.Member.FetchMembership)
+
+	me.GET("/preferences", sl.Acc.FetchPreferences)
+	me.PATCH("/preferences", sl.Acc.UpdatePreferences)
+
+	me.GET("/instructions", sl.Inst.FetchInstructions)
+	me.PUT("/instructions", sl.Inst.UpdateInstructions)
+	me.DELETE("/instructions", sl.Inst.ClearInstructions)
+
+	me.GET("/history", sl.History.FetchHistory)
+	me.DELETE("/history", sl.History.FlushHistory)
+
+	me.GET("/sessions", sl.Auth.ListSessions)
+	me.DELETE("/sessions/:sid", sl.Auth.RevokeSession)
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/devproje/neko-engine/common"
+	"github.com/devproje/neko-engine/config"
 	"github.com/devproje/neko-engine/core/route"
 	"github.com/gin-gonic/gin"
 )
@@ -13,7 +14,8 @@ func NewServerCore(sl *common.ServiceLoader) {
 	app := gin.Default()
 	route.CoreRouter(app, sl)
 
-	if err := app.Run(":8080"); err != nil {
+	cnf := config.Load().Server
+	if err := app.Run(fmt.Sprintf("%s:%d", cnf.Host, cnf.Port)); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 		return
 	}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/devproje/neko-engine/common"
+	"github.com/devproje/neko-engine/common/service"
 	"github.com/devproje/neko-engine/internal/route"
 	"github.com/gin-gonic/gin"
 )
@@ -18,14 +19,55 @@ func NewInternalServer(sl *common.ServiceLoader) {
 
 	go func() {
 		for {
-			now := time.Now()
-			next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(24 * time.Hour)
-			time.Sleep(time.Until(next))
+			report, err := sl.Reset.Run()
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+
+			if report != nil && report.Reset {
+				fmt.Println("Reset janitor: reset chat counts")
+			}
 
-			fmt.Println("Resetting count at midnight...")
-			if err := sl.Acc.Acc.ResetCount(); err != nil {
-				fmt.Fprintf(os.Stderr, "%v\n", err)
+			if report != nil && report.Rolled > 0 {
+				fmt.Printf("Reset janitor: reset chat counts of %d users\n", report.Rolled)
 			}
+
+			time.Sleep(service.RESET_CHECK_INTERVAL)
+		}
+	}()
+
+	go func() {
+		for {
+			report, err := sl.Retention.Sweep()
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+
+			if report != nil {
+				fmt.Printf("Retention janitor: expired %d, trimmed %d, purged %d history rows\n",
+					report.Expired, report.Trimmed, report.Purged,
+				)
+			}
+
+			reverted, err := sl.Account.RevertExpiredRoles()
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+
+			if reverted > 0 {
+				fmt.Printf("Role janitor: reverted %d expired roles\n", reverted)
+			}
+
+			lifted, err := sl.Account.LiftExpiredBans()
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+
+			if lifted > 0 {
+				fmt.Printf("Ban janitor: lifted %d expired bans\n", lifted)
+			}
+
+			time.Sleep(sl.Retention.Interval())
 		}
 	}()
 
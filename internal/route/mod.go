@@ -17,8 +17,54 @@ func InternalRouter(app *gin.Engine, sl *common.ServiceLoader) {
 			"info":    config.GetVersionInfo(),
 		})
 	})
-	app.GET("/@me/:id", sl.Acc.FetchAccount)
-
-	app.POST("/chat", sl.Chat.SendChat)
 	app.POST("/register", sl.Acc.RegisterUser)
+
+	// user facing endpoints, banned users are rejected here
+	user := app.Group("", middleware.CheckBan(sl.Account))
+	user.GET("/@me/:id/instructions", sl.Inst.FetchInstructions)
+	user.PUT("/@me/:id/instructions", sl.Inst.UpdateInstructions)
+	user.DELETE("/@me/:id/instructions", sl.Inst.ClearInstructions)
+
+	user.POST("/chat", sl.Chat.SendChat)
+	user.POST("/chat/regenerate", sl.Chat.RegenerateChat)
+	user.POST("/chat/edit", sl.Chat.EditChat)
+
+	user.GET("/history/:id", sl.History.FetchHistory)
+	user.DELETE("/history/:id", sl.History.FlushHistory)
+	user.DELETE("/history/:id/last", sl.History.PurgeLast)
+	user.GET("/history/:id/search", sl.History.SearchHistory)
+	user.DELETE("/history/:id/:hid", sl.History.DeleteHistory)
+	user.GET("/history/:id/:hid/branches", sl.History.FetchBranches)
+	user.POST("/history/:id/:hid/checkout", sl.History.CheckoutBranch)
+
+	app.GET("/roles", sl.Role.ListRoles)
+	app.POST("/roles", sl.Role.CreateRole)
+	app.PATCH("/roles/:rid", sl.Role.UpdateRole)
+	app.DELETE("/roles/:rid", sl.Role.DeleteRole)
+
+	app.GET("/usage", sl.Usage.FetchUsage)
+
+	app.POST("/guilds", sl.Guild.CreateGuild)
+	app.GET("/guilds/:gid", sl.Guild.FetchGuild)
+	app.PATCH("/guilds/:gid", sl.Guild.UpdateGuild)
+	app.DELETE("/guilds/:gid", sl.Guild.DeleteGuild)
+	app.GET("/guilds/:gid/usage", sl.Guild.FetchGuildUsage)
+
+	// messages of banned authors are kept out of the shared context
+	user.POST("/channel/:cid/messages", sl.Channel.IngestMessage)
+	app.DELETE("/channel/:cid", sl.Channel.FlushChannel)
+
+	user.GET("/account/:id/usage", sl.Usage.FetchAccountUsage)
+	user.GET("/account/:id/credits", sl.Acc.FetchCredits)
+	user.GET("/account/:id/membership", sl.Member.FetchMembership)
+	user.GET("/account/:id/export", sl.Archive.ExportAccount)
+	user.POST("/account/:id/import", sl.Archive.ImportAccount)
+
+	// moderation endpoints act on the user, so they must reach banned users
+	app.PUT("/account/:id/role", sl.Acc.AssignRole)
+	app.GET("/account/:id/role/changes", sl.Acc.FetchRoleChanges)
+	app.POST("/account/:id/ban", sl.Acc.BanUser)
+	app.DELETE("/account/:id/ban", sl.Acc.UnbanUser)
+	app.POST("/account/:id/credits", sl.Acc.GrantCredits)
+	app.POST("/account/:id/membership", sl.Member.ReportMembership)
 }
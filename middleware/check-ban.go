@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const ERRCODE_BANNED = "USER_BANNED"
+
+// UserReader loads an account by its ID. Expired bans are lifted by the
+// reader, so CheckBan only sees bans that are still active.
+type UserReader interface {
+	ReadUser(id string) (*repository.User, error)
+}
+
+// CheckBan rejects requests of banned users. The user is taken from the
+// ":id" path parameter or the "id" or "author_id" field of the JSON body.
+func CheckBan(acc UserReader) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		if id == "" {
+			var body struct {
+				Id       string `json:"id"`
+				AuthorId string `json:"author_id"`
+			}
+
+			_ = ctx.ShouldBindBodyWithJSON(&body)
+			id = body.Id
+			if id == "" {
+				id = body.AuthorId
+			}
+		}
+
+		if id == "" {
+			ctx.Next()
+			return
+		}
+
+		usr, err := acc.ReadUser(id)
+		if err != nil || !usr.Banned {
+			ctx.Next()
+			return
+		}
+
+		ctx.AbortWithStatusJSON(403, gin.H{
+			"errno":      "You are banned from using the bot.",
+			"code":       ERRCODE_BANNED,
+			"reason":     usr.BanReason,
+			"expires_at": usr.BanExpiresAt,
+		})
+	}
+}
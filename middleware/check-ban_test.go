@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type fakeUsers map[string]*repository.User
+
+func (f fakeUsers) ReadUser(id string) (*repository.User, error) {
+	usr, ok := f[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return usr, nil
+}
+
+func newBanRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	users := fakeUsers{
+		"banned": {ID: "banned", Banned: true, BanReason: "spam"},
+		"user":   {ID: "user"},
+	}
+
+	app := gin.New()
+	user := app.Group("", CheckBan(users))
+	user.POST("/chat/regenerate", func(ctx *gin.Context) {
+		var body struct {
+			Id string `json:"id"`
+		}
+
+		if err := ctx.ShouldBindBodyWithJSON(&body); err != nil {
+			ctx.Status(400)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"id": body.Id})
+	})
+	user.GET("/history/:id", func(ctx *gin.Context) {
+		ctx.Status(200)
+	})
+	user.POST("/channel/:cid/messages", func(ctx *gin.Context) {
+		ctx.Status(204)
+	})
+
+	return app
+}
+
+func serve(app *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCheckBanRegenerate(t *testing.T) {
+	app := newBanRouter()
+
+	rec := serve(app, http.MethodPost, "/chat/regenerate", `{"id":"banned"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("POST /chat/regenerate of a banned user returned %d, want 403", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), ERRCODE_BANNED) {
+		t.Errorf("POST /chat/regenerate of a banned user returned %s without %s", rec.Body, ERRCODE_BANNED)
+	}
+
+	// the body is read by the middleware and must still reach the handler
+	rec = serve(app, http.MethodPost, "/chat/regenerate", `{"id":"user"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"user"`) {
+		t.Errorf("POST /chat/regenerate of a user returned %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckBanSources(t *testing.T) {
+	app := newBanRouter()
+
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/history/banned", "", http.StatusForbidden},
+		{http.MethodGet, "/history/user", "", http.StatusOK},
+		{http.MethodGet, "/history/unknown", "", http.StatusOK},
+		{http.MethodPost, "/channel/1/messages", `{"author_id":"banned"}`, http.StatusForbidden},
+		{http.MethodPost, "/channel/1/messages", `{"author_id":"user"}`, http.StatusNoContent},
+	}
+
+	for _, c := range cases {
+		if rec := serve(app, c.method, c.path, c.body); rec.Code != c.want {
+			t.Errorf("%s %s %s returned %d, want %d", c.method, c.path, c.body, rec.Code, c.want)
+		}
+	}
+}
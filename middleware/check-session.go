@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/devproje/neko-engine/common/repository"
+	"github.com/devproje/neko-engine/common/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SESSION_COOKIE = "neko_session"
+	SESSION_KEY    = "session"
+)
+
+// CheckSession rejects requests without a valid login session. The token
+// is taken from the "Authorization: Bearer" header or the session cookie,
+// and the session is stored in the context under SESSION_KEY.
+func CheckSession(ss *service.SessionService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			token, _ = ctx.Cookie(SESSION_COOKIE)
+		}
+
+		if token == "" {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"errno": "Please log in first.",
+			})
+			return
+		}
+
+		session, err := ss.Verify(token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"errno": "Your session has expired. Please log in again.",
+			})
+			return
+		}
+
+		ctx.Set(SESSION_KEY, session)
+		ctx.Next()
+	}
+}
+
+// SessionUser exposes the user of the session as the ":id" path parameter,
+// so the per-user handlers serve the logged-in user only.
+func SessionUser(ctx *gin.Context) {
+	session := ctx.MustGet(SESSION_KEY).(*repository.Session)
+	ctx.Params = append(ctx.Params, gin.Param{Key: "id", Value: session.UserID})
+	ctx.Next()
+}
@@ -0,0 +1,275 @@
+package util
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/devproje/neko-engine/config"
+)
+
+// ENVELOPE_PREFIX marks encrypted values. The full format is
+// "nk1:<key id>:<wrapped data key>:<sealed value>" with both payloads
+// stored as base64 encoded nonce and AES-GCM ciphertext.
+//
+// ESCAPE_PREFIX is put in front of plaintext stored while encryption is
+// disabled if it starts with one of the prefixes, so user input can never
+// be mistaken for an envelope. Plaintext stored before values were escaped
+// may start with it as well, so rows must record whether their values are
+// escaped and pass that to Decrypt and Rotate.
+const (
+	ENVELOPE_PREFIX = "nk1:"
+	ESCAPE_PREFIX   = "nk0:"
+)
+
+var (
+	ErrUnknownKey = errors.New("encryption key is not found")
+	ErrEnvelope   = errors.New("malformed encrypted value")
+)
+
+type Keyring struct {
+	enabled bool
+	active  string
+	keys    map[string][]byte
+}
+
+var (
+	keyring     *Keyring
+	keyringErr  error
+	keyringOnce sync.Once
+)
+
+// GetKeyring returns the process wide keyring loaded from the config.
+func GetKeyring() (*Keyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = LoadKeyring(config.Load().Encryption)
+	})
+
+	return keyring, keyringErr
+}
+
+func LoadKeyring(cnf config.EncryptionConfig) (*Keyring, error) {
+	ring := Keyring{
+		enabled: cnf.Enabled,
+		active:  cnf.ActiveKey,
+		keys:    make(map[string][]byte),
+	}
+
+	raw := make(map[string]string)
+	for id, key := range cnf.Keys {
+		raw[id] = key
+	}
+
+	if cnf.KeyFile != "" {
+		file, err := os.Open(cnf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			id, key, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid key file line: %s", line)
+			}
+
+			raw[strings.TrimSpace(id)] = strings.Trim(strings.TrimSpace(key), "\"")
+		}
+
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for id, key := range raw {
+		buf, err := hex.DecodeString(key)
+		if err != nil || len(buf) != 32 {
+			return nil, fmt.Errorf("encryption key \"%s\" must be 32 bytes of hex", id)
+		}
+
+		ring.keys[id] = buf
+	}
+
+	if ring.enabled {
+		if _, ok := ring.keys[ring.active]; !ok {
+			return nil, fmt.Errorf("%w: active key \"%s\"", ErrUnknownKey, ring.active)
+		}
+	}
+
+	return &ring, nil
+}
+
+func (k *Keyring) Enabled() bool {
+	return k.enabled
+}
+
+// Current reports whether value is already sealed with the active key,
+// or is plaintext while encryption is disabled.
+func (k *Keyring) Current(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	if !IsEncrypted(value) {
+		return !k.enabled
+	}
+
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, ENVELOPE_PREFIX), ":")
+	return k.enabled && id == k.active
+}
+
+// IsEncrypted reports whether a stored value is an envelope. Only values
+// read from the database should be passed, plaintext from users is
+// escaped by Encrypt before it is stored.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ENVELOPE_PREFIX)
+}
+
+func escape(value string) string {
+	if strings.HasPrefix(value, ENVELOPE_PREFIX) || strings.HasPrefix(value, ESCAPE_PREFIX) {
+		return ESCAPE_PREFIX + value
+	}
+
+	return value
+}
+
+// Rotate re-seals value with the active key, or returns the escaped
+// plaintext if encryption has been disabled.
+func (k *Keyring) Rotate(value string, escaped bool) (string, error) {
+	plain, err := k.Decrypt(value, escaped)
+	if err != nil {
+		return "", err
+	}
+
+	return k.Encrypt(plain)
+}
+
+func seal(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrEnvelope
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Encrypt seals value with a fresh data key wrapped by the active key.
+// While encryption is disabled the plaintext is stored, escaped if it
+// looks like an envelope.
+func (k *Keyring) Encrypt(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+
+	if !k.enabled {
+		return escape(value), nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.active], dek)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dek, []byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s:%s:%s", ENVELOPE_PREFIX, k.active,
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(sealed),
+	), nil
+}
+
+// Decrypt opens an encrypted value. escaped tells whether the value was
+// stored by Encrypt, plaintext values written before that are returned
+// unchanged.
+func (k *Keyring) Decrypt(value string, escaped bool) (string, error) {
+	if escaped && strings.HasPrefix(value, ESCAPE_PREFIX) {
+		return strings.TrimPrefix(value, ESCAPE_PREFIX), nil
+	}
+
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, ENVELOPE_PREFIX), ":")
+	if len(parts) != 3 {
+		return "", ErrEnvelope
+	}
+
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: \"%s\"", ErrUnknownKey, parts[0])
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrEnvelope
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrEnvelope
+	}
+
+	dek, err := open(kek, wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := open(dek, sealed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
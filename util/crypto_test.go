@@ -0,0 +1,128 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/devproje/neko-engine/config"
+)
+
+const TEST_KEY = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func testKeyring(t *testing.T, enabled bool) *Keyring {
+	t.Helper()
+
+	ring, err := LoadKeyring(config.EncryptionConfig{
+		Enabled:   enabled,
+		ActiveKey: "k1",
+		Keys:      map[string]string{"k1": TEST_KEY},
+	})
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	return ring
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	values := []string{
+		"hello",
+		"nk1:x:y:z",
+		"nk1:k1:AAAA:AAAA",
+		"nk0:escaped",
+		"nk0:nk1:x:y:z",
+	}
+
+	for _, enabled := range []bool{true, false} {
+		ring := testKeyring(t, enabled)
+		for _, value := range values {
+			stored, err := ring.Encrypt(value)
+			if err != nil {
+				t.Fatalf("Encrypt(%q, enabled=%v): %v", value, enabled, err)
+			}
+
+			if enabled && (stored == value || !IsEncrypted(stored)) {
+				t.Errorf("Encrypt(%q) stored %q, want a sealed envelope", value, stored)
+			}
+
+			plain, err := ring.Decrypt(stored, true)
+			if err != nil {
+				t.Fatalf("Decrypt(%q, enabled=%v): %v", stored, enabled, err)
+			}
+
+			if plain != value {
+				t.Errorf("round trip of %q (enabled=%v) returned %q", value, enabled, plain)
+			}
+		}
+	}
+}
+
+func TestKeyringForgedEnvelope(t *testing.T) {
+	ring := testKeyring(t, false)
+
+	stored, err := ring.Encrypt("nk1:x:y:z")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if IsEncrypted(stored) || !strings.HasPrefix(stored, ESCAPE_PREFIX) {
+		t.Errorf("plaintext %q was stored as %q, want it escaped", "nk1:x:y:z", stored)
+	}
+
+	// a stored envelope with a bad payload is still rejected
+	if _, err = ring.Decrypt("nk1:x:y:z", true); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt of a forged envelope returned %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyringLegacyPlaintext(t *testing.T) {
+	ring := testKeyring(t, false)
+
+	// stored before values were escaped, so the prefix is part of the text
+	plain, err := ring.Decrypt("nk0:legacy", false)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+
+	if plain != "nk0:legacy" {
+		t.Errorf("Decrypt of legacy plaintext returned %q, want it unchanged", plain)
+	}
+
+	stored, err := ring.Rotate("nk0:legacy", false)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if plain, _ = ring.Decrypt(stored, true); plain != "nk0:legacy" {
+		t.Errorf("Rotate of legacy plaintext stored %q, which reads back as %q", stored, plain)
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	plain := testKeyring(t, false)
+	sealed := testKeyring(t, true)
+
+	stored, _ := plain.Encrypt("nk1:x:y:z")
+	if !plain.Current(stored) || sealed.Current(stored) {
+		t.Fatalf("Current(%q) does not match the keyring state", stored)
+	}
+
+	rotated, err := sealed.Rotate(stored, true)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if !sealed.Current(rotated) {
+		t.Errorf("rotated value %q is not sealed with the active key", rotated)
+	}
+
+	back, err := plain.Rotate(rotated, true)
+	if err != nil {
+		t.Fatalf("Rotate back: %v", err)
+	}
+
+	if back != stored {
+		t.Errorf("rotating back returned %q, want %q", back, stored)
+	}
+}
@@ -52,3 +52,11 @@ func (d *Database) Close() error {
 	}
 	return nil
 }
+
+// Transaction runs fn inside a database transaction. Repositories created
+// from the database passed to fn take part in it.
+func (d *Database) Transaction(fn func(tx *Database) error) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{db: tx})
+	})
+}